@@ -0,0 +1,475 @@
+package api
+
+import (
+	"auth_service/pkg/clientip"
+	"auth_service/service"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	sessionCookie = "auth_session"
+	// loginCSRFCookie holds the token the login form has to post back, as
+	// there is no session yet to tie it to.
+	loginCSRFCookie = "auth_login_csrf"
+)
+
+//go:embed templates/openid.html
+var templateFS embed.FS
+
+var pages = template.Must(template.ParseFS(templateFS, "templates/openid.html"))
+
+// scopeDescriptions are shown on the consent page; other scopes are shown by
+// name.
+var scopeDescriptions = map[string]string{
+	"openid":           "Know who you are",
+	"profile":          "See your name, picture, language and time zone",
+	"email":            "See your email address",
+	"phone":            "See your phone number",
+	"profile:read":     "See your profile",
+	"profile:write":    "Change your profile",
+	"orders:read":      "See your orders",
+	"orders:write":     "Place and change orders",
+	"deliveries:read":  "See your deliveries",
+	"deliveries:write": "Update your deliveries",
+	"menu:read":        "See your restaurant's menu",
+	"menu:write":       "Change your restaurant's menu",
+}
+
+// page is the data of the login and consent pages.
+type page struct {
+	Client      string
+	Request     *service.AuthorizationRequest
+	Scopes      []string
+	Email       string
+	MfaRequired bool
+	Error       string
+	CSRF        string
+}
+
+// openIDHandler serves the endpoints of the OpenID Connect provider.
+type openIDHandler struct {
+	provider  *service.OpenIDProvider
+	clientIPs *clientip.Resolver
+}
+
+func (h *openIDHandler) discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, h.provider.Discovery())
+}
+
+// authorize runs the authorization code flow. GET starts it; the login and
+// consent pages post back to it with the parameters of the request.
+func (h *openIDHandler) authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := h.requestContext(r)
+	req := &service.AuthorizationRequest{
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		ResponseType:        r.FormValue("response_type"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		Nonce:               r.FormValue("nonce"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Prompt:              r.URL.Query().Get("prompt"),
+	}
+
+	client, err := h.provider.Client(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		h.showError(w, err)
+		return
+	}
+	if err := h.provider.CheckRequest(client, req); err != nil {
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	pg := &page{Client: client.Name, Request: req}
+	session := h.provider.Session(ctx, cookieValue(r, sessionCookie))
+	prompt := strings.Fields(req.Prompt)
+	consented := false
+
+	switch action := r.PostFormValue("action"); {
+	case r.Method == http.MethodGet:
+		if slices.Contains(prompt, "login") {
+			session = nil
+		}
+	case action == "login":
+		if !validLoginCSRF(r) {
+			pg.Error = "The page expired, please try again."
+			render(w, http.StatusBadRequest, "error", pg)
+			return
+		}
+		pg.Email = r.PostFormValue("email")
+		session, err = h.provider.Login(ctx, pg.Email, r.PostFormValue("password"), r.PostFormValue("code"))
+		if err != nil {
+			h.loginFailed(w, r, pg, err)
+			return
+		}
+		h.setSession(w, session)
+	case action == "consent" || action == "deny":
+		if session == nil {
+			h.showLogin(w, r, http.StatusOK, pg)
+			return
+		}
+		if !validCSRF(session, r.PostFormValue("csrf")) {
+			pg.Error = "The page expired, please try again."
+			render(w, http.StatusBadRequest, "error", pg)
+			return
+		}
+		if action == "deny" {
+			h.redirectError(w, r, req, &service.OAuthError{Code: "access_denied", Description: "the user denied access"})
+			return
+		}
+		consented = true
+	default:
+		pg.Error = "Unknown action."
+		render(w, http.StatusBadRequest, "error", pg)
+		return
+	}
+
+	if session == nil {
+		if slices.Contains(prompt, "none") {
+			h.redirectError(w, r, req, &service.OAuthError{Code: "login_required", Description: "the user isn't logged in"})
+			return
+		}
+		h.showLogin(w, r, http.StatusOK, pg)
+		return
+	}
+
+	scopes, err := h.provider.GrantScopes(ctx, client, session.UserID, req)
+	if err != nil {
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	if consented {
+		if err := h.provider.Consent(ctx, client, session.UserID, scopes); err != nil {
+			h.redirectError(w, r, req, err)
+			return
+		}
+	} else {
+		needsConsent, err := h.provider.NeedsConsent(ctx, client, session.UserID, scopes)
+		if err != nil {
+			h.redirectError(w, r, req, err)
+			return
+		}
+		if slices.Contains(prompt, "consent") && !client.FirstParty {
+			needsConsent = true
+		}
+		if needsConsent {
+			if slices.Contains(prompt, "none") {
+				h.redirectError(w, r, req, &service.OAuthError{Code: "consent_required", Description: "the user hasn't consented to the client"})
+				return
+			}
+			for _, scope := range scopes {
+				pg.Scopes = append(pg.Scopes, describeScope(scope))
+			}
+			pg.CSRF = csrfToken(session)
+			render(w, http.StatusOK, "consent", pg)
+			return
+		}
+	}
+
+	code, err := h.provider.IssueCode(ctx, req, session, scopes)
+	if err != nil {
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	h.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// loginFailed shows the login page again with what went wrong.
+func (h *openIDHandler) loginFailed(w http.ResponseWriter, r *http.Request, pg *page, err error) {
+	if errors.Is(err, service.ErrMfaRequired) {
+		pg.MfaRequired = true
+		pg.Error = "Enter your password again together with a verification code."
+		h.showLogin(w, r, http.StatusOK, pg)
+		return
+	}
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.Unknown || st.Code() == codes.Internal {
+		log.Println("OpenID login failed: ", err)
+		pg.Error = "Something went wrong, please try again later."
+		render(w, http.StatusInternalServerError, "error", pg)
+		return
+	}
+
+	pg.MfaRequired = errors.Is(err, service.ErrInvalidVerificationCode)
+	pg.Error = st.Message()
+	h.showLogin(w, r, http.StatusOK, pg)
+}
+
+// showLogin renders the login page. Its form posts back a token that has to
+// match a cookie, so that other sites can't log the browser in to an account
+// of theirs.
+func (h *openIDHandler) showLogin(w http.ResponseWriter, r *http.Request, statusCode int, pg *page) {
+	token := cookieValue(r, loginCSRFCookie)
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			log.Println("Failed to create login csrf token: ", err)
+			render(w, http.StatusInternalServerError, "error", &page{Error: "Something went wrong, please try again later."})
+			return
+		}
+		token = hex.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCSRFCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(h.provider.Issuer(), "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	pg.CSRF = token
+	render(w, statusCode, "login", pg)
+}
+
+func (h *openIDHandler) setSession(w http.ResponseWriter, session *service.BrowserSession) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.Token,
+		Path:     "/",
+		MaxAge:   int(h.provider.SessionTTL().Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.provider.Issuer(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// showError shows errors that can't be sent to the redirect URI.
+func (h *openIDHandler) showError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Println("OpenID authorization failed: ", err)
+		render(w, http.StatusInternalServerError, "error", &page{Error: "Something went wrong, please try again later."})
+		return
+	}
+
+	render(w, http.StatusBadRequest, "error", &page{Error: "The application sent an invalid request: " + oauthErr.Description + "."})
+}
+
+// redirectError sends the error to the client at its redirect URI.
+func (h *openIDHandler) redirectError(w http.ResponseWriter, r *http.Request, req *service.AuthorizationRequest, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Println("OpenID authorization failed: ", err)
+		oauthErr = &service.OAuthError{Code: "server_error", Description: "internal error"}
+	}
+
+	h.redirect(w, r, req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+// redirect sends the user back to the client with the parameters, the state
+// and the issuer (RFC 9207).
+func (h *openIDHandler) redirect(w http.ResponseWriter, r *http.Request, req *service.AuthorizationRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		h.showError(w, err)
+		return
+	}
+
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", h.provider.Issuer())
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// token serves the token endpoint. Clients authenticate with HTTP Basic or
+// with client_id and client_secret in the form.
+func (h *openIDHandler) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "invalid form body"})
+		return
+	}
+
+	req := &service.TokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+		RefreshToken: r.PostFormValue("refresh_token"),
+		Scope:        r.PostFormValue("scope"),
+		ClientID:     r.PostFormValue("client_id"),
+		ClientSecret: r.PostFormValue("client_secret"),
+	}
+	if id, secret, ok := r.BasicAuth(); ok {
+		// Both are form encoded before they are put in the header.
+		id, err1 := url.QueryUnescape(id)
+		secret, err2 := url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil || (req.ClientID != "" && req.ClientID != id) || req.ClientSecret != "" {
+			writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "use one way to authenticate the client"})
+			return
+		}
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	resp, err := h.provider.Token(h.requestContext(r), req)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// userinfo serves the claims of the user of a bearer access token.
+func (h *openIDHandler) userinfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.provider.UserInfo(h.requestContext(r), token)
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		statusCode := http.StatusUnauthorized
+		if oauthErr.Code == "insufficient_scope" {
+			statusCode = http.StatusForbidden
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q, error_description=%q", oauthErr.Code, oauthErr.Description))
+		w.WriteHeader(statusCode)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to get userinfo: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// cors lets browser apps call the endpoint from other origins. The endpoints
+// it wraps don't use cookies, so any origin is fine.
+func cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "3600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Println("OpenID token request failed: ", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	statusCode := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		statusCode = http.StatusUnauthorized
+	}
+
+	writeJSON(w, statusCode, map[string]string{
+		"error":             oauthErr.Code,
+		"error_description": oauthErr.Description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to write response: ", err)
+	}
+}
+
+// render writes one of the pages. They must not be framed by other sites, or
+// a user could be tricked into clicking Allow.
+func render(w http.ResponseWriter, statusCode int, name string, pg *page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(statusCode)
+
+	if err := pages.ExecuteTemplate(w, name, pg); err != nil {
+		log.Println("Failed to render page: ", err)
+	}
+}
+
+func describeScope(scope string) string {
+	if description, ok := scopeDescriptions[scope]; ok {
+		return description
+	}
+	return scope
+}
+
+// csrfToken ties the consent form to the browser session. Other sites can't
+// read the session cookie, so they can't compute it.
+func csrfToken(session *service.BrowserSession) string {
+	sum := sha256.Sum256([]byte("csrf:" + session.Token))
+	return hex.EncodeToString(sum[:16])
+}
+
+func validCSRF(session *service.BrowserSession, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(csrfToken(session)), []byte(token)) == 1
+}
+
+func validLoginCSRF(r *http.Request) bool {
+	token := cookieValue(r, loginCSRFCookie)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(r.PostFormValue("csrf"))) == 1
+}
+
+func cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// requestContext passes the address and user agent of the end user on to the
+// service, as the gRPC server does for its calls.
+func (h *openIDHandler) requestContext(r *http.Request) context.Context {
+	ip := h.clientIPs.Resolve(r.RemoteAddr, strings.Join(r.Header.Values("X-Forwarded-For"), ","), r.Header.Get("X-Real-IP"))
+	return service.ContextWithClient(r.Context(), ip, r.UserAgent())
+}
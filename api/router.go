@@ -1 +1,47 @@
 package api
+
+import (
+	"auth_service/pkg/blob"
+	"auth_service/pkg/clientip"
+	"auth_service/pkg/jwtkeys"
+	"auth_service/service"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// NewRouter serves the HTTP endpoints other services use next to the gRPC API,
+// the OpenID Connect provider, and the files of local blob storage under
+// /media/.
+func NewRouter(keys *jwtkeys.Keyring, blobs blob.Storage, openID *service.OpenIDProvider, clientIPs *clientip.Resolver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jwks.json", cors(jwksHandler(keys)))
+
+	op := &openIDHandler{provider: openID, clientIPs: clientIPs}
+	mux.HandleFunc("GET /.well-known/openid-configuration", cors(op.discovery))
+	mux.HandleFunc("GET /authorize", op.authorize)
+	mux.HandleFunc("POST /authorize", op.authorize)
+	mux.HandleFunc("POST /token", cors(op.token))
+	mux.HandleFunc("OPTIONS /token", cors(op.token))
+	mux.HandleFunc("GET /userinfo", cors(op.userinfo))
+	mux.HandleFunc("POST /userinfo", cors(op.userinfo))
+	mux.HandleFunc("OPTIONS /userinfo", cors(op.userinfo))
+	if local, ok := blobs.(*blob.Local); ok {
+		mux.Handle("GET /media/", http.StripPrefix("/media", local.Handler()))
+	}
+
+	return mux
+}
+
+func jwksHandler(keys *jwtkeys.Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Verifiers may cache the set for a while, new keys are published
+		// before they are used for signing.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+
+		if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+			log.Println("Failed to write jwks: ", err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"auth_service/config"
+	"auth_service/models"
+	postgres "auth_service/storage/postgres"
+	"context"
+	"log"
+)
+
+// grantAdmins gives the admin role to the users in ADMIN_USER_IDS. Failures
+// are only logged, the users may not have registered yet.
+func grantAdmins(roles *postgres.RoleImpl, cnf config.AdminConfig) {
+	for _, userID := range cnf.UserIDs {
+		granted, err := roles.Grant(context.Background(), userID, models.RoleAdmin, "")
+		if err != nil {
+			log.Printf("Failed to grant admin role to %s: %v", userID, err)
+			continue
+		}
+		if granted {
+			log.Printf("Granted admin role to %s", userID)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"auth_service/pkg/jwtkeys"
+	"auth_service/service"
+	"context"
+	"fmt"
+	"log"
+)
+
+// initKeyring loads the signing keys. On the first start, when Postgres has
+// none yet, it imports the keys in JWT_KEY_DIR, active right away. It fails
+// if no key can sign, rather than making one up that other instances and
+// verifiers don't know.
+func initKeyring(signingKeys *service.SigningKeys, keys *jwtkeys.Keyring) error {
+	ctx := context.Background()
+
+	imported, err := signingKeys.Import(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sk := range imported {
+		log.Printf("Signing keyring was empty, imported %s key %s", sk.Algorithm, sk.KID)
+	}
+
+	if err := signingKeys.Reload(ctx); err != nil {
+		return err
+	}
+	if _, err := keys.SigningKey(); err != nil {
+		return fmt.Errorf("%v: put the private key of an active key in JWT_KEY_DIR, or add one with cmd/keys", err)
+	}
+
+	return nil
+}
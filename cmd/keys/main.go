@@ -0,0 +1,148 @@
+// Command keys manages the keyring tokens are signed with.
+//
+//	go run ./cmd/keys list
+//	go run ./cmd/keys add [-alg RS256|EdDSA] [-activate-in 10m]
+//	go run ./cmd/keys import -file key.pem [-activate-in 10m]
+//	go run ./cmd/keys retire -kid <kid> [-in 24h]
+//
+// New keys are written to JWT_KEY_DIR, which every instance has to share;
+// Postgres only gets their public keys.
+//
+// Running instances pick up changes on their next keyring reload.
+package main
+
+import (
+	"auth_service/config"
+	"auth_service/pkg/jwtkeys"
+	pkgPostgres "auth_service/pkg/postgres"
+	"auth_service/service"
+	postgres "auth_service/storage/postgres"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// defaultRetirement keeps a retired key verifying for as long as the refresh
+// tokens it signed last.
+const defaultRetirement = 24 * time.Hour
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cnf := config.NewConfig()
+	cnf.Load()
+
+	db, err := pkgPostgres.ConnectDB(cnf.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	signingKeys := service.NewSigningKeys(postgres.NewSigningKeySQL(db), jwtkeys.NewKeyring(), cnf.JWT.KeyDir)
+	ctx := context.Background()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "list":
+		err = list(ctx, signingKeys)
+	case "add":
+		err = add(ctx, signingKeys, cnf.JWT, args)
+	case "import":
+		err = importKey(ctx, signingKeys, cnf.JWT, args)
+	case "retire":
+		err = retire(ctx, signingKeys, args)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keys list | add [-alg RS256|EdDSA] [-activate-in d] | import -file key.pem [-activate-in d] | retire -kid kid [-in d]")
+	os.Exit(2)
+}
+
+func list(ctx context.Context, signingKeys *service.SigningKeys) error {
+	keys, err := signingKeys.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		retireAt := "-"
+		if key.RetireAt != nil {
+			retireAt = key.RetireAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\tactivates %s\tretires %s\n", key.KID, key.Algorithm, key.ActivatesAt.Format(time.RFC3339), retireAt)
+	}
+
+	return nil
+}
+
+func add(ctx context.Context, signingKeys *service.SigningKeys, cnf config.JWTConfig, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	alg := fs.String("alg", cnf.Algorithm, "algorithm, RS256 or EdDSA")
+	activateIn := fs.Duration("activate-in", cnf.KeyActivationDelay, "how long the key is only published before it signs")
+	fs.Parse(args)
+
+	key, err := jwtkeys.GenerateKey(*alg)
+	if err != nil {
+		return err
+	}
+
+	return store(ctx, signingKeys, key, *activateIn)
+}
+
+func importKey(ctx context.Context, signingKeys *service.SigningKeys, cnf config.JWTConfig, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "PEM encoded RSA or Ed25519 private key, copied to JWT_KEY_DIR")
+	activateIn := fs.Duration("activate-in", cnf.KeyActivationDelay, "how long the key is only published before it signs")
+	fs.Parse(args)
+
+	if *file == "" {
+		usage()
+	}
+
+	key, err := jwtkeys.LoadPrivateKey(*file)
+	if err != nil {
+		return err
+	}
+
+	return store(ctx, signingKeys, key, *activateIn)
+}
+
+func store(ctx context.Context, signingKeys *service.SigningKeys, key *jwtkeys.Key, activateIn time.Duration) error {
+	sk, err := signingKeys.Add(ctx, key, time.Now().Add(activateIn))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %s key %s, signing from %s\n", sk.Algorithm, sk.KID, sk.ActivatesAt.Format(time.RFC3339))
+	return nil
+}
+
+func retire(ctx context.Context, signingKeys *service.SigningKeys, args []string) error {
+	fs := flag.NewFlagSet("retire", flag.ExitOnError)
+	kid := fs.String("kid", "", "key to retire")
+	in := fs.Duration("in", defaultRetirement, "how long the key keeps verifying tokens")
+	fs.Parse(args)
+
+	if *kid == "" {
+		usage()
+	}
+
+	at := time.Now().Add(*in)
+	if err := signingKeys.Retire(ctx, *kid, at); err != nil {
+		return fmt.Errorf("failed to retire key %s: %v", *kid, err)
+	}
+
+	fmt.Printf("Key %s retires at %s\n", *kid, at.Format(time.RFC3339))
+	return nil
+}
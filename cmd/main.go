@@ -1,15 +1,26 @@
 package main
 
 import (
+	"auth_service/api"
 	"auth_service/config"
+	"auth_service/pkg/blob"
+	"auth_service/pkg/clientip"
+	"auth_service/pkg/hasher"
+	"auth_service/pkg/jwtkeys"
+	"auth_service/pkg/oidc"
 	pkgPostgres "auth_service/pkg/postgres"
 	pkgRedis "auth_service/pkg/redis"
+	"auth_service/pkg/sms"
 	"auth_service/storage/cache"
 	postgres "auth_service/storage/postgres"
+	"context"
 	"log"
+	// Time zones are validated against the embedded database, the image has none.
+	_ "time/tzdata"
 
 	"auth_service/server"
 	"auth_service/service"
+	"auth_service/service/passwordpolicy"
 )
 
 func main() {
@@ -25,14 +36,70 @@ func main() {
 	authCache := cache.NewAuthCache(rClient)
 	emailCacher := cache.NewEmailCache(rClient)
 	tokenCacher := cache.NewTokenCache(rClient)
+	loginAttempts := cache.NewLoginAttemptCache(rClient, cnf.Lockout)
+	mfaCache := cache.NewMfaCache(rClient)
+	profileCache := cache.NewProfileCache(rClient)
+	settingsCache := cache.NewSettingsCache(rClient)
+	phoneCodes := cache.NewPhoneCodeCache(rClient, cnf.PhoneLogin)
+	authCodes := cache.NewAuthCodeCache(rClient)
 
-	user := postgres.NewUserManagementSQL(db, authCache)
+	passwordHasher, err := hasher.New(cnf.Hasher)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	user := postgres.NewUserManagementSQL(db, authCache, passwordHasher)
+	twoFactor := postgres.NewTwoFactorSQL(db)
+	recoveryCodes := postgres.NewRecoveryCodeSQL(db)
+	securityEvents := postgres.NewSecurityEventSQL(db)
+	passwordResets := postgres.NewPasswordResetSQL(db)
+	tokens := postgres.NewTokenSQL(db)
+	roles := postgres.NewRoleSQL(db)
+	scopes := postgres.NewScopeSQL(db)
+	profiles := postgres.NewUserProfileSQL(db, profileCache)
+	settings := postgres.NewUserSettingsSQL(db, settingsCache)
+	grantAdmins(roles, cnf.Admin)
+
+	passwordPolicy, err := passwordpolicy.New(cnf.Password)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys := jwtkeys.NewKeyring()
+	signingKeys := service.NewSigningKeys(postgres.NewSigningKeySQL(db), keys, cnf.JWT.KeyDir)
+	if err := initKeyring(signingKeys, keys); err != nil {
+		log.Fatal(err)
+	}
+	go signingKeys.Watch(context.Background(), cnf.JWT.KeyringReload)
+
+	blobs, err := blob.New(cnf.Blob)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	smsSender, err := sms.New(cnf.Sms)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	emailSenderService := service.NewEmailSender(cnf.EmailSender, emailCacher)
 
-	authService := service.NewAuthService(user, emailSenderService, cnf, tokenCacher)
+	authService := service.NewAuthService(user, emailSenderService, cnf, tokenCacher, loginAttempts, twoFactor, mfaCache, recoveryCodes, securityEvents, passwordResets, tokens, passwordPolicy, passwordHasher, keys, roles, scopes, settings, phoneCodes, smsSender, postgres.NewIdentitySQL(db), oidc.NewProviders(cnf.OIDCProviders), postgres.NewOAuthClientSQL(db), postgres.NewConsentSQL(db))
+	userService := service.NewUserService(user, profiles, settings, blobs, cnf)
+	openID := service.NewOpenIDProvider(authService, profiles, authCodes, cnf.OpenID)
+
+	clientIPs, err := clientip.New(cnf.Gateway)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		if err := server.RunHTTP(api.NewRouter(keys, blobs, openID, clientIPs), *cnf); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
-	if err := server.Run(authService, *cnf); err != nil {
+	if err := server.Run(*cnf, authService, userService); err != nil {
 		log.Fatal(err)
 	}
 }
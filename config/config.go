@@ -1,7 +1,11 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,8 +19,26 @@ type (
 		Redis       RedisConfig
 		JWT         JWTConfig
 		RabbitMQ    RabbitMQConfig
-		Auth        string
-		Booking     string
+		Lockout     LockoutConfig
+		Mfa         MfaConfig
+		Reset       PasswordResetConfig
+		Password    PasswordPolicyConfig
+		Hasher      HasherConfig
+		Admin       AdminConfig
+		Internal    InternalConfig
+		Gateway     GatewayConfig
+		Settings    UserSettingsConfig
+		Profile     ProfileConfig
+		Blob        BlobConfig
+		Sms         SmsConfig
+		PhoneLogin  PhoneLoginConfig
+		MagicLink   MagicLinkConfig
+		// OIDCProviders are the identity providers LoginWithIdToken accepts,
+		// keyed by name. Providers without client IDs are left out.
+		OIDCProviders map[string]OIDCProviderConfig
+		OpenID        OpenIDConfig
+		Auth          string
+		Booking       string
 	}
 	EmailSenderConfig struct {
 		SMTPServer  string
@@ -30,7 +52,17 @@ type (
 	}
 
 	JWTConfig struct {
-		SecretKey string
+		// KeyDir holds the private keys as PEM encoded RSA or Ed25519 files,
+		// one per key. Postgres only has their public keys and schedule.
+		KeyDir string
+		// Algorithm of generated keys, "RS256" or "EdDSA".
+		Algorithm string
+		// KeyringReload is how often the keyring is reloaded from Postgres.
+		KeyringReload time.Duration
+		// KeyActivationDelay is how long a new key is only published in the
+		// JWKS before it starts signing. It should be longer than verifiers
+		// cache the JWKS.
+		KeyActivationDelay time.Duration
 	}
 
 	ServerConfig struct {
@@ -51,6 +83,151 @@ type (
 	RabbitMQConfig struct {
 		RabbitMQ string
 	}
+	LockoutConfig struct {
+		// MaxAttempts is the number of failed logins for one email before it is locked.
+		MaxAttempts int
+		// MaxAttemptsPerIP is the same threshold for a single client IP.
+		MaxAttemptsPerIP int
+		// Window is how long failed attempts are remembered.
+		Window time.Duration
+		// BaseDuration is the first lock period; every further lock doubles it.
+		BaseDuration time.Duration
+		// MaxDuration caps the lock period.
+		MaxDuration time.Duration
+	}
+	MfaConfig struct {
+		// Issuer is the account label shown in authenticator apps.
+		Issuer       string
+		ChallengeTTL time.Duration
+		// MaxAttempts is the number of wrong codes allowed per login challenge.
+		MaxAttempts int
+	}
+	PasswordResetConfig struct {
+		// LinkBaseURL is the page of the client app that asks for the new
+		// password; the reset token is appended as the "token" query parameter.
+		LinkBaseURL string
+		TTL         time.Duration
+		// ResendInterval is the least time between two reset emails to one
+		// email address, and between two requests from one client IP.
+		ResendInterval time.Duration
+	}
+	PasswordPolicyConfig struct {
+		MinLength int
+		// MaxBytes guards against bcrypt silently ignoring input past 72 bytes.
+		MaxBytes         int
+		RequireUppercase bool
+		RequireLowercase bool
+		RequireDigit     bool
+		RequireSymbol    bool
+		// BlocklistFile lists common passwords that are always rejected.
+		BlocklistFile string
+	}
+	HasherConfig struct {
+		// Algorithm is used for new hashes, "argon2id" or "bcrypt". Hashes
+		// made with other algorithms or parameters are upgraded on login.
+		Algorithm string
+		// Argon2Memory is in KiB.
+		Argon2Memory      uint32
+		Argon2Iterations  uint32
+		Argon2Parallelism uint8
+		Argon2SaltLength  uint32
+		Argon2KeyLength   uint32
+		BcryptCost        int
+	}
+	GatewayConfig struct {
+		// TrustedProxies are the addresses or CIDR ranges of the API gateway
+		// and load balancers. Only their X-Forwarded-For and X-Real-IP
+		// headers are believed; without any, the peer address is used.
+		TrustedProxies []string
+	}
+	InternalConfig struct {
+		// ServiceTokens maps the names of internal services to the tokens
+		// they send in the "x-service-token" metadata.
+		ServiceTokens map[string]string
+	}
+	UserSettingsConfig struct {
+		// Languages users may choose from, as BCP 47 tags.
+		Languages       []string
+		DefaultLanguage string
+		// DefaultTimeZone is an IANA time zone name.
+		DefaultTimeZone string
+	}
+	ProfileConfig struct {
+		// PictureMaxBytes limits uploaded profile pictures.
+		PictureMaxBytes int
+		// PictureMaxPixels limits width times height, so that small files
+		// can't decode into huge images.
+		PictureMaxPixels int
+	}
+	BlobConfig struct {
+		// Backend is "local" or "s3".
+		Backend string
+		// PublicURL is the base URL stored files are served at. The local
+		// backend's files are served by the HTTP server under /media/; S3
+		// objects default to their endpoint URL.
+		PublicURL string
+		LocalDir  string
+		// S3Endpoint of an S3-compatible service, e.g. http://minio:9000.
+		S3Endpoint  string
+		S3Region    string
+		S3Bucket    string
+		S3AccessKey string
+		S3SecretKey string
+		// S3PathStyle addresses buckets as endpoint/bucket instead of
+		// bucket.endpoint, which most local stand-ins need.
+		S3PathStyle bool
+	}
+	SmsConfig struct {
+		// Backend is "log", which writes messages to the service log, or
+		// "file", which appends them to File as JSON lines. Both are meant
+		// for development and tests.
+		Backend string
+		File    string
+	}
+	PhoneLoginConfig struct {
+		CodeTTL time.Duration
+		// MaxAttempts is the number of wrong codes allowed per sent code.
+		MaxAttempts int
+		// ResendInterval is the least time between two codes to one number.
+		ResendInterval time.Duration
+		// MaxSendsPerHour caps the codes sent to one number.
+		MaxSendsPerHour int
+		// MaxSendsPerHourPerIP caps the codes one client IP gets sent to any
+		// numbers, so that texting isn't run up on purpose.
+		MaxSendsPerHourPerIP int
+	}
+	MagicLinkConfig struct {
+		// LinkBaseURL is the page of the client app that finishes the login;
+		// the token is appended as the "token" query parameter.
+		LinkBaseURL string
+		TTL         time.Duration
+		// ResendInterval is the least time between two links to one email,
+		// and between two requests from one client IP.
+		ResendInterval time.Duration
+	}
+	OIDCProviderConfig struct {
+		// Issuers are the accepted "iss" values; Google uses two.
+		Issuers []string
+		JWKSURL string
+		// ClientIDs are the accepted audiences, one per app registered
+		// with the provider.
+		ClientIDs []string
+	}
+	// OpenIDConfig configures the OpenID Connect provider served over HTTP.
+	OpenIDConfig struct {
+		// Issuer is the public base URL of the HTTP server, e.g.
+		// https://auth.example.com. The endpoints are served under it.
+		Issuer string
+		// CodeTTL is how long an authorization code can be exchanged.
+		CodeTTL time.Duration
+		// SessionTTL is how long a browser stays logged in to the provider.
+		SessionTTL time.Duration
+	}
+	AdminConfig struct {
+		// UserIDs are granted the admin role on startup, so that there is
+		// someone to grant roles to everyone else.
+		UserIDs []string
+	}
 )
 
 func (c *Config) Load() error {
@@ -78,10 +255,102 @@ func (c *Config) Load() error {
 	c.EmailSender.Password = os.Getenv("EMAIL_PASS")
 	c.EmailSender.SenderEmail = os.Getenv("SENDER_EMAIL")
 
-	c.JWT.SecretKey = os.Getenv("JWT_SECRET_KEY")
+	c.JWT.KeyDir = getEnv("JWT_KEY_DIR", "keys")
+	c.JWT.Algorithm = getEnv("JWT_KEY_ALGORITHM", "RS256")
+	c.JWT.KeyringReload = getEnvDuration("JWT_KEYRING_RELOAD", time.Minute)
+	c.JWT.KeyActivationDelay = getEnvDuration("JWT_KEY_ACTIVATION_DELAY", 10*time.Minute)
 
 	c.RabbitMQ.RabbitMQ = os.Getenv("RABBITMQ_URI")
 
+	c.Lockout.MaxAttempts = getEnvInt("LOCKOUT_MAX_ATTEMPTS", 5)
+	c.Lockout.MaxAttemptsPerIP = getEnvInt("LOCKOUT_MAX_ATTEMPTS_PER_IP", 20)
+	c.Lockout.Window = getEnvDuration("LOCKOUT_WINDOW", 15*time.Minute)
+	c.Lockout.BaseDuration = getEnvDuration("LOCKOUT_BASE_DURATION", time.Minute)
+	c.Lockout.MaxDuration = getEnvDuration("LOCKOUT_MAX_DURATION", time.Hour)
+
+	c.Mfa.Issuer = getEnv("MFA_ISSUER", "Food Delivery")
+	c.Mfa.ChallengeTTL = getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute)
+	c.Mfa.MaxAttempts = getEnvInt("MFA_MAX_ATTEMPTS", 5)
+
+	c.Reset.LinkBaseURL = os.Getenv("PASSWORD_RESET_URL")
+	c.Reset.TTL = getEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+	c.Reset.ResendInterval = getEnvDuration("PASSWORD_RESET_RESEND_INTERVAL", time.Minute)
+
+	c.Password.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	c.Password.MaxBytes = getEnvInt("PASSWORD_MAX_BYTES", 72)
+	c.Password.RequireUppercase = getEnvBool("PASSWORD_REQUIRE_UPPERCASE", true)
+	c.Password.RequireLowercase = getEnvBool("PASSWORD_REQUIRE_LOWERCASE", true)
+	c.Password.RequireDigit = getEnvBool("PASSWORD_REQUIRE_DIGIT", true)
+	c.Password.RequireSymbol = getEnvBool("PASSWORD_REQUIRE_SYMBOL", false)
+	c.Password.BlocklistFile = getEnv("PASSWORD_BLOCKLIST_FILE", "config/common_passwords.txt")
+
+	c.Hasher.Algorithm = getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	c.Hasher.Argon2Memory = uint32(getEnvInt("ARGON2_MEMORY_KIB", 64*1024))
+	c.Hasher.Argon2Iterations = uint32(getEnvInt("ARGON2_ITERATIONS", 3))
+	c.Hasher.Argon2Parallelism = uint8(getEnvInt("ARGON2_PARALLELISM", 2))
+	c.Hasher.Argon2SaltLength = uint32(getEnvInt("ARGON2_SALT_LENGTH", 16))
+	c.Hasher.Argon2KeyLength = uint32(getEnvInt("ARGON2_KEY_LENGTH", 32))
+	c.Hasher.BcryptCost = getEnvInt("BCRYPT_COST", 10)
+
+	c.Sms.Backend = getEnv("SMS_BACKEND", "log")
+	c.Sms.File = getEnv("SMS_FILE", "sms.jsonl")
+
+	c.PhoneLogin.CodeTTL = getEnvDuration("PHONE_CODE_TTL", 5*time.Minute)
+	c.PhoneLogin.MaxAttempts = getEnvInt("PHONE_CODE_MAX_ATTEMPTS", 5)
+	c.PhoneLogin.ResendInterval = getEnvDuration("PHONE_CODE_RESEND_INTERVAL", time.Minute)
+	c.PhoneLogin.MaxSendsPerHour = getEnvInt("PHONE_CODE_MAX_SENDS_PER_HOUR", 5)
+	c.PhoneLogin.MaxSendsPerHourPerIP = getEnvInt("PHONE_CODE_MAX_SENDS_PER_HOUR_PER_IP", 20)
+
+	c.MagicLink.LinkBaseURL = os.Getenv("MAGIC_LINK_URL")
+	c.MagicLink.TTL = getEnvDuration("MAGIC_LINK_TTL", 15*time.Minute)
+	c.MagicLink.ResendInterval = getEnvDuration("MAGIC_LINK_RESEND_INTERVAL", time.Minute)
+
+	c.OIDCProviders = make(map[string]OIDCProviderConfig)
+	google := OIDCProviderConfig{
+		Issuers:   getEnvListDefault("GOOGLE_ISSUERS", "https://accounts.google.com", "accounts.google.com"),
+		JWKSURL:   getEnv("GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
+		ClientIDs: getEnvList("GOOGLE_CLIENT_IDS"),
+	}
+	if len(google.ClientIDs) > 0 {
+		c.OIDCProviders["google"] = google
+	}
+	apple := OIDCProviderConfig{
+		Issuers:   getEnvListDefault("APPLE_ISSUERS", "https://appleid.apple.com"),
+		JWKSURL:   getEnv("APPLE_JWKS_URL", "https://appleid.apple.com/auth/keys"),
+		ClientIDs: getEnvList("APPLE_CLIENT_IDS"),
+	}
+	if len(apple.ClientIDs) > 0 {
+		c.OIDCProviders["apple"] = apple
+	}
+
+	c.OpenID.Issuer = strings.TrimSuffix(getEnv("OIDC_ISSUER", "http://localhost:8080"), "/")
+	c.OpenID.CodeTTL = getEnvDuration("OIDC_CODE_TTL", time.Minute)
+	c.OpenID.SessionTTL = getEnvDuration("OIDC_SESSION_TTL", 12*time.Hour)
+
+	c.Admin.UserIDs = getEnvList("ADMIN_USER_IDS")
+	c.Internal.ServiceTokens = getEnvMap("INTERNAL_SERVICE_TOKENS")
+	c.Gateway.TrustedProxies = getEnvList("TRUSTED_PROXIES")
+
+	c.Settings.Languages = getEnvListDefault("SUPPORTED_LANGUAGES", "en", "ru", "uz")
+	c.Settings.DefaultLanguage = getEnv("DEFAULT_LANGUAGE", "en")
+	c.Settings.DefaultTimeZone = getEnv("DEFAULT_TIME_ZONE", "UTC")
+
+	c.Profile.PictureMaxBytes = getEnvInt("PROFILE_PICTURE_MAX_BYTES", 5<<20)
+	c.Profile.PictureMaxPixels = getEnvInt("PROFILE_PICTURE_MAX_PIXELS", 25_000_000)
+
+	c.Blob.Backend = getEnv("BLOB_BACKEND", "local")
+	c.Blob.PublicURL = os.Getenv("BLOB_PUBLIC_URL")
+	if c.Blob.PublicURL == "" && c.Blob.Backend == "local" {
+		c.Blob.PublicURL = "http://localhost:8080/media"
+	}
+	c.Blob.LocalDir = getEnv("BLOB_LOCAL_DIR", "media")
+	c.Blob.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	c.Blob.S3Region = getEnv("S3_REGION", "us-east-1")
+	c.Blob.S3Bucket = os.Getenv("S3_BUCKET")
+	c.Blob.S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	c.Blob.S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	c.Blob.S3PathStyle = getEnvBool("S3_PATH_STYLE", false)
+
 	// pp.Println(c)
 
 	return nil
@@ -90,3 +359,81 @@ func (c *Config) Load() error {
 func NewConfig() *Config {
 	return &Config{}
 }
+
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvList splits a comma separated variable, dropping empty items.
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func getEnvListDefault(key string, def ...string) []string {
+	if list := getEnvList(key); len(list) > 0 {
+		return list
+	}
+	return def
+}
+
+// getEnvMap parses a comma separated list of name:value pairs.
+func getEnvMap(key string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range getEnvList(key) {
+		name, value, ok := strings.Cut(item, ":")
+		if !ok || name == "" || value == "" {
+			log.Printf("Invalid %s item %q, expected name:value", key, name)
+			continue
+		}
+		m[name] = value
+	}
+	return m
+}
+
+func getEnvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %t", key, v, def)
+		return def
+	}
+	return b
+}
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %s", key, v, def)
+		return def
+	}
+	return d
+}
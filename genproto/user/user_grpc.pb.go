@@ -24,6 +24,7 @@ const _ = grpc.SupportPackageIsVersion7
 type UserServiceClient interface {
 	GetUserProfile(ctx context.Context, in *GetUserProfileRequest, opts ...grpc.CallOption) (*GetUserProfileResponse, error)
 	UpdateUserProfile(ctx context.Context, in *UpdateUserProfileRequest, opts ...grpc.CallOption) (*UpdateUserProfileResponse, error)
+	UploadProfilePicture(ctx context.Context, opts ...grpc.CallOption) (UserService_UploadProfilePictureClient, error)
 	GetUserSettings(ctx context.Context, in *GetUserSettingsRequest, opts ...grpc.CallOption) (*GetUserSettingsResponse, error)
 	UpdateUserSettings(ctx context.Context, in *UpdateUserSettingsRequest, opts ...grpc.CallOption) (*UpdateUserSettingsResponse, error)
 }
@@ -54,6 +55,40 @@ func (c *userServiceClient) UpdateUserProfile(ctx context.Context, in *UpdateUse
 	return out, nil
 }
 
+func (c *userServiceClient) UploadProfilePicture(ctx context.Context, opts ...grpc.CallOption) (UserService_UploadProfilePictureClient, error) {
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[0], "/user.UserService/UploadProfilePicture", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &userServiceUploadProfilePictureClient{stream}
+	return x, nil
+}
+
+type UserService_UploadProfilePictureClient interface {
+	Send(*UploadProfilePictureRequest) error
+	CloseAndRecv() (*UploadProfilePictureResponse, error)
+	grpc.ClientStream
+}
+
+type userServiceUploadProfilePictureClient struct {
+	grpc.ClientStream
+}
+
+func (x *userServiceUploadProfilePictureClient) Send(m *UploadProfilePictureRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *userServiceUploadProfilePictureClient) CloseAndRecv() (*UploadProfilePictureResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadProfilePictureResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *userServiceClient) GetUserSettings(ctx context.Context, in *GetUserSettingsRequest, opts ...grpc.CallOption) (*GetUserSettingsResponse, error) {
 	out := new(GetUserSettingsResponse)
 	err := c.cc.Invoke(ctx, "/user.UserService/GetUserSettings", in, out, opts...)
@@ -78,6 +113,7 @@ func (c *userServiceClient) UpdateUserSettings(ctx context.Context, in *UpdateUs
 type UserServiceServer interface {
 	GetUserProfile(context.Context, *GetUserProfileRequest) (*GetUserProfileResponse, error)
 	UpdateUserProfile(context.Context, *UpdateUserProfileRequest) (*UpdateUserProfileResponse, error)
+	UploadProfilePicture(UserService_UploadProfilePictureServer) error
 	GetUserSettings(context.Context, *GetUserSettingsRequest) (*GetUserSettingsResponse, error)
 	UpdateUserSettings(context.Context, *UpdateUserSettingsRequest) (*UpdateUserSettingsResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
@@ -93,6 +129,9 @@ func (UnimplementedUserServiceServer) GetUserProfile(context.Context, *GetUserPr
 func (UnimplementedUserServiceServer) UpdateUserProfile(context.Context, *UpdateUserProfileRequest) (*UpdateUserProfileResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserProfile not implemented")
 }
+func (UnimplementedUserServiceServer) UploadProfilePicture(UserService_UploadProfilePictureServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadProfilePicture not implemented")
+}
 func (UnimplementedUserServiceServer) GetUserSettings(context.Context, *GetUserSettingsRequest) (*GetUserSettingsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserSettings not implemented")
 }
@@ -148,6 +187,32 @@ func _UserService_UpdateUserProfile_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_UploadProfilePicture_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UserServiceServer).UploadProfilePicture(&userServiceUploadProfilePictureServer{stream})
+}
+
+type UserService_UploadProfilePictureServer interface {
+	SendAndClose(*UploadProfilePictureResponse) error
+	Recv() (*UploadProfilePictureRequest, error)
+	grpc.ServerStream
+}
+
+type userServiceUploadProfilePictureServer struct {
+	grpc.ServerStream
+}
+
+func (x *userServiceUploadProfilePictureServer) SendAndClose(m *UploadProfilePictureResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *userServiceUploadProfilePictureServer) Recv() (*UploadProfilePictureRequest, error) {
+	m := new(UploadProfilePictureRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _UserService_GetUserSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetUserSettingsRequest)
 	if err := dec(in); err != nil {
@@ -208,6 +273,12 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _UserService_UpdateUserSettings_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadProfilePicture",
+			Handler:       _UserService_UploadProfilePicture_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "user/user.proto",
 }
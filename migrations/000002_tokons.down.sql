@@ -1 +1,4 @@
-DROP TABLE tokens;
\ No newline at end of file
+DROP INDEX idx_tokens_family_id;
+DROP INDEX idx_tokens_user_id;
+
+DROP TABLE IF EXISTS tokens;
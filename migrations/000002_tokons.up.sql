@@ -1,8 +1,17 @@
-CREATE TABLE tokens(
-    user_id UUID REFERENCES users(id),
-    access_token TEXT,
-    refresh_token TEXT,
-    is_revoked BOOLEAN 'FALSE',
-    expiry TIMESTAMP,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-)
\ No newline at end of file
+-- Every issued refresh token. Access tokens are short-lived and not stored.
+CREATE TABLE tokens (
+    jti UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    family_id UUID NOT NULL, -- all tokens rotated from one login
+    device_name VARCHAR(255),
+    user_agent TEXT,
+    ip_address VARCHAR(64),
+    is_revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked_at TIMESTAMPTZ,
+    revoke_reason VARCHAR(64),
+    replaced_by UUID, -- set once the token has been rotated
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_tokens_user_id ON tokens(user_id);
+CREATE INDEX idx_tokens_family_id ON tokens(family_id);
@@ -0,0 +1,3 @@
+ALTER TABLE two_factor_auth DROP COLUMN last_used_step;
+ALTER TABLE two_factor_auth DROP CONSTRAINT two_factor_auth_user_id_key;
+ALTER TABLE two_factor_auth ALTER COLUMN enabled SET DEFAULT TRUE;
@@ -0,0 +1,6 @@
+-- 2FA stays off until the user confirms enrollment with a valid code.
+ALTER TABLE two_factor_auth ALTER COLUMN enabled SET DEFAULT FALSE;
+ALTER TABLE two_factor_auth ADD CONSTRAINT two_factor_auth_user_id_key UNIQUE (user_id);
+
+-- Last accepted TOTP time step, so a code can't be replayed within its window.
+ALTER TABLE two_factor_auth ADD COLUMN last_used_step BIGINT NOT NULL DEFAULT 0;
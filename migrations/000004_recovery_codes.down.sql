@@ -0,0 +1,3 @@
+DROP INDEX idx_recovery_codes_user_id_code_hash;
+
+DROP TABLE IF EXISTS recovery_codes;
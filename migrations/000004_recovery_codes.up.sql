@@ -0,0 +1,8 @@
+CREATE TABLE recovery_codes (
+    code_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- hex SHA-256 of the normalized code, the code itself is shown to the user once
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_recovery_codes_user_id_code_hash ON recovery_codes(user_id, code_hash);
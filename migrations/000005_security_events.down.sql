@@ -0,0 +1,3 @@
+DROP INDEX idx_security_events_user_id;
+
+DROP TABLE IF EXISTS security_events;
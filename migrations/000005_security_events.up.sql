@@ -0,0 +1,9 @@
+CREATE TABLE security_events (
+    event_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(user_id) ON DELETE CASCADE,
+    event_type VARCHAR(64) NOT NULL,
+    ip_address VARCHAR(64),
+    details TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_security_events_user_id ON security_events(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE password_resets DROP COLUMN used_at;
+ALTER TABLE password_resets DROP COLUMN expires_at;
+ALTER TABLE password_resets ALTER COLUMN reset_id DROP DEFAULT;
@@ -0,0 +1,4 @@
+-- reset_token holds the SHA-256 of the token, the token itself is only sent by email.
+ALTER TABLE password_resets ALTER COLUMN reset_id SET DEFAULT gen_random_uuid();
+ALTER TABLE password_resets ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE password_resets ADD COLUMN used_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- Tokens carry the generation they were issued in; bumping it revokes them all.
+ALTER TABLE users ADD COLUMN token_generation BIGINT NOT NULL DEFAULT 0;
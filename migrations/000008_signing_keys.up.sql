@@ -0,0 +1,11 @@
+-- Keyring the tokens are signed with. The newest active key signs, every key
+-- keeps verifying and stays in the JWKS until retire_at. Only the public keys
+-- are stored; the private ones stay in the PEM files of JWT_KEY_DIR.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    activates_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    retire_at TIMESTAMPTZ
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS roles (
+    role VARCHAR(32) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO roles (role, description) VALUES
+    ('customer', 'Orders food'),
+    ('courier', 'Delivers orders'),
+    ('restaurant_staff', 'Manages a restaurant and its orders'),
+    ('admin', 'Manages the platform and its users')
+ON CONFLICT (role) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+    granted_by UUID,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+-- Everyone registered so far signed up as a customer.
+INSERT INTO user_roles (user_id, role)
+SELECT user_id, 'customer' FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens DROP COLUMN client_id;
+ALTER TABLE tokens DROP COLUMN scope;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS role_scopes;
@@ -0,0 +1,43 @@
+-- Scopes a role may be granted. A user may be granted the scopes of all their roles.
+CREATE TABLE IF NOT EXISTS role_scopes (
+    role VARCHAR(32) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+    scope VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role, scope)
+);
+
+INSERT INTO role_scopes (role, scope) VALUES
+    ('customer', 'profile:read'),
+    ('customer', 'profile:write'),
+    ('customer', 'orders:read'),
+    ('customer', 'orders:write'),
+    ('courier', 'profile:read'),
+    ('courier', 'profile:write'),
+    ('courier', 'deliveries:read'),
+    ('courier', 'deliveries:write'),
+    ('restaurant_staff', 'profile:read'),
+    ('restaurant_staff', 'profile:write'),
+    ('restaurant_staff', 'orders:read'),
+    ('restaurant_staff', 'orders:write'),
+    ('restaurant_staff', 'menu:read'),
+    ('restaurant_staff', 'menu:write'),
+    ('admin', 'users:admin')
+ON CONFLICT DO NOTHING;
+
+-- Client applications and the scopes tokens issued to them may carry.
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    client_id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    allowed_scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO oauth_clients (client_id, name, allowed_scopes) VALUES
+    ('customer-app', 'Customer app', '{profile:read,profile:write,orders:read,orders:write}'),
+    ('courier-app', 'Courier app', '{profile:read,profile:write,deliveries:read,deliveries:write}'),
+    ('restaurant-tablet', 'Restaurant tablet', '{orders:read}')
+ON CONFLICT (client_id) DO NOTHING;
+
+-- Refresh tokens remember what their login was granted, so that a refresh
+-- can't widen it. Tokens issued before scopes existed get none on refresh.
+ALTER TABLE tokens ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN client_id VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    language VARCHAR(16) NOT NULL DEFAULT 'en',
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    notification_preferences JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Users registered so far get the defaults; empty preferences mean the
+-- default channels for every event.
+INSERT INTO user_settings (user_id)
+SELECT user_id FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_phone_number;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_number;
+DELETE FROM users WHERE email IS NULL;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
@@ -0,0 +1,4 @@
+-- Users who sign up with a phone number have no email and no password.
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_number VARCHAR(20);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_number ON users(phone_number);
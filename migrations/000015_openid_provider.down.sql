@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS oauth_consents;
+
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS first_party;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS redirect_uris;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS secret_hash;
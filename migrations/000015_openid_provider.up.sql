@@ -0,0 +1,16 @@
+-- Clients of the OpenID Connect provider. Confidential clients authenticate
+-- at the token endpoint with their secret, public ones only with PKCE.
+ALTER TABLE oauth_clients ADD COLUMN secret_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+-- Users aren't asked to consent to first party clients.
+ALTER TABLE oauth_clients ADD COLUMN first_party BOOLEAN NOT NULL DEFAULT false;
+
+-- Scopes users allowed a client to access on their behalf.
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is an application tokens are issued to.
+type OAuthClient struct {
+	ClientID      string   `json:"client_id"`
+	Name          string   `json:"name"`
+	AllowedScopes []string `json:"allowed_scopes"`
+	// SecretHash is the SHA-256 of the client secret, empty for public
+	// clients.
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	FirstParty   bool      `json:"first_party"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Confidential reports whether the client has a secret to authenticate with.
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AllowsRedirect reports whether uri is registered for the client. URIs are
+// compared as plain strings, as OAuth 2.0 Security BCP asks.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
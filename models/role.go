@@ -0,0 +1,8 @@
+package models
+
+const (
+	RoleCustomer        = "customer"
+	RoleCourier         = "courier"
+	RoleRestaurantStaff = "restaurant_staff"
+	RoleAdmin           = "admin"
+)
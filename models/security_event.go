@@ -0,0 +1,21 @@
+package models
+
+const (
+	SecurityEventRecoveryCodeUsed  = "recovery_code_used"
+	SecurityEventPasswordReset     = "password_reset"
+	SecurityEventPasswordChanged   = "password_changed"
+	SecurityEventRefreshReuse      = "refresh_token_reuse"
+	SecurityEventLogoutAll         = "logout_all"
+	SecurityEventRoleGranted       = "role_granted"
+	SecurityEventRoleRevoked       = "role_revoked"
+	SecurityEventTwoFactorDisabled = "two_factor_disabled"
+)
+
+type SecurityEvent struct {
+	EventID   string `json:"event_id"`
+	UserID    string `json:"user_id"`
+	EventType string `json:"event_type"`
+	IPAddress string `json:"ip_address"`
+	Details   string `json:"details"`
+	CreatedAt string `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is one login of a user: the refresh token family started by
+// CreateToken, described by its device and current token.
+type Session struct {
+	SessionID  string    `json:"session_id"`
+	UserID     string    `json:"user_id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
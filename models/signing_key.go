@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SigningKey is a key of the token signing keyring. PublicKey is PEM encoded;
+// the private key is kept in a file, never in the database.
+type SigningKey struct {
+	KID         string     `json:"kid"`
+	Algorithm   string     `json:"algorithm"`
+	PublicKey   string     `json:"public_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetireAt    *time.Time `json:"retire_at"`
+}
@@ -1,8 +1,80 @@
 package models
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMagicLink tokens are sent in login links and can only be
+	// exchanged with ConsumeMagicLink.
+	TokenTypeMagicLink = "magic_link"
+	// TokenTypeBrowserSession tokens are kept in a cookie by the browser
+	// logged in to the OpenID Connect provider.
+	TokenTypeBrowserSession = "browser_session"
+)
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	TokenType string `json:"token_type,omitempty"`
+	// FamilyID identifies the login (session) the token belongs to; all
+	// refresh tokens rotated from one login share it.
+	FamilyID string `json:"fid,omitempty"`
+	// Generation is the token generation of the user at issuance. Tokens
+	// from an older generation are rejected.
+	Generation int64 `json:"gen"`
+	// Roles of the user, only in access tokens. They are read again on every
+	// refresh, so a grant shows up with the next access token.
+	Roles []string `json:"roles,omitempty"`
+	// Scope is space separated, as in RFC 9068.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
+
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// Reasons recorded when a refresh token is revoked.
+const (
+	RevokeReasonRotated           = "rotated"
+	RevokeReasonReuseDetected     = "reuse_detected"
+	RevokeReasonLogout            = "logout"
+	RevokeReasonPasswordChanged   = "password_changed"
+	RevokeReasonPasswordReset     = "password_reset"
+	RevokeReasonLogoutAll         = "logout_all"
+	RevokeReasonRoleRevoked       = "role_revoked"
+	RevokeReasonConsentRevoked    = "consent_revoked"
+	RevokeReasonTwoFactorDisabled = "two_factor_disabled"
+	// RevokeReasonSuperseded is reported for tokens issued before the user's
+	// tokens were last revoked all at once.
+	RevokeReasonSuperseded = "superseded"
+	// RevokeReasonRevoked is reported for access tokens revoked by RevokeToken.
+	RevokeReasonRevoked = "revoked"
+)
+
+// Token is a stored refresh token.
+type Token struct {
+	JTI          string `json:"jti"`
+	UserID       string `json:"user_id"`
+	FamilyID     string `json:"family_id"`
+	DeviceName   string `json:"device_name"`
+	UserAgent    string `json:"user_agent"`
+	IPAddress    string `json:"ip_address"`
+	IsRevoked    bool   `json:"is_revoked"`
+	RevokeReason string `json:"revoke_reason"`
+	ReplacedBy   string `json:"replaced_by"`
+	// Scope is what the login was granted, space separated.
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+	// Generation is the token generation of the user the token was issued in.
+	// It is carried in the token, not stored.
+	Generation int64     `json:"-"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
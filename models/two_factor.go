@@ -0,0 +1,10 @@
+package models
+
+type TwoFactor struct {
+	AuthID       string `json:"auth_id"`
+	UserID       string `json:"user_id"`
+	Secret       string `json:"secret"`
+	Enabled      bool   `json:"enabled"`
+	LastUsedStep int64  `json:"last_used_step"`
+	CreatedAt    string `json:"created_at"`
+}
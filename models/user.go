@@ -3,6 +3,7 @@ package models
 type User struct {
 	UserId         string `json:"user_id"`
 	Email          string `json:"email"`
+	PhoneNumber    string `json:"phone_number"`
 	HashedPassword string `json:"hashed_password"`
 	Name           string `json:"name"`
 	IsVerified     bool   `json:"is_verified"`
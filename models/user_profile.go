@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserProfile holds the personal details of a user shown across the apps.
+type UserProfile struct {
+	UserID         string    `json:"user_id"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	PhoneNumber    string    `json:"phone_number"`
+	ProfilePicture string    `json:"profile_picture"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// UserSettings are the preferences of a user. NotificationPreferences is
+// the JSON encoding of NotificationPreferences.
+type UserSettings struct {
+	UserID                  string    `json:"user_id"`
+	Language                string    `json:"language"`
+	TimeZone                string    `json:"time_zone"`
+	NotificationPreferences string    `json:"notification_preferences"`
+	UpdatedAt               time.Time `json:"updated_at"`
+}
+
+// NotificationPreferences maps notification events to the channels a user
+// gets them on, for example:
+//
+//	{"order_status": ["push", "sms"], "promotions": []}
+//
+// Keys are NotificationEvents, values NotificationChannels without
+// duplicates. An empty list turns the event off; events left out keep
+// their default channels.
+type NotificationPreferences map[string][]string
+
+const (
+	NotificationEventOrderStatus = "order_status"
+	NotificationEventDelivery    = "delivery"
+	NotificationEventPromotions  = "promotions"
+	NotificationEventSecurity    = "security"
+)
+
+const (
+	NotificationChannelPush  = "push"
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+)
+
+var (
+	NotificationEvents = []string{
+		NotificationEventOrderStatus,
+		NotificationEventDelivery,
+		NotificationEventPromotions,
+		NotificationEventSecurity,
+	}
+	NotificationChannels = []string{
+		NotificationChannelPush,
+		NotificationChannelEmail,
+		NotificationChannelSMS,
+	}
+)
+
+// DefaultNotificationPreferences are the channels of new users.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{
+		NotificationEventOrderStatus: {NotificationChannelPush},
+		NotificationEventDelivery:    {NotificationChannelPush},
+		NotificationEventPromotions:  {NotificationChannelEmail},
+		NotificationEventSecurity:    {NotificationChannelEmail},
+	}
+}
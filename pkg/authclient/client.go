@@ -0,0 +1,128 @@
+// Package authclient is what other food-delivery services use to talk to the
+// auth service: a typed client, a verifier that checks access tokens locally
+// against the published JWKS, gRPC server interceptors that authenticate and
+// authorize incoming calls, and an in-memory fake for unit tests.
+package authclient
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/pkg/jwtkeys"
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Tokens is a token pair handed out by the auth service.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// Scope is space separated.
+	Scope string
+}
+
+// Introspection is what the auth service knows about a token right now.
+type Introspection struct {
+	Active           bool
+	UserID           string
+	Email            string
+	TokenType        string
+	SessionID        string
+	Roles            []string
+	Scope            string
+	IssuedAt         time.Time
+	ExpiresAt        time.Time
+	RevocationReason string
+}
+
+// Client is a typed wrapper of auth.AuthServiceClient for the calls other
+// services need. Raw gives access to the rest.
+type Client struct {
+	raw auth.AuthServiceClient
+}
+
+func New(conn grpc.ClientConnInterface) *Client {
+	return &Client{raw: auth.NewAuthServiceClient(conn)}
+}
+
+func (c *Client) Raw() auth.AuthServiceClient {
+	return c.raw
+}
+
+// CreateToken starts a login for a user the caller has authenticated itself.
+func (c *Client) CreateToken(ctx context.Context, req *auth.CreateTokenRequest) (*Tokens, error) {
+	resp, err := c.raw.CreateToken(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{AccessToken: resp.AccessToken, RefreshToken: resp.RefreshToken, Scope: resp.Scope}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. scopes may narrow the
+// scopes of the new access token.
+func (c *Client) Refresh(ctx context.Context, refreshToken string, scopes ...string) (*Tokens, error) {
+	resp, err := c.raw.RefreshToken(ctx, &auth.RefreshTokenRequest{RefreshToken: refreshToken, Scopes: scopes})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{AccessToken: resp.AccessToken, RefreshToken: resp.RefreshToken, Scope: resp.Scope}, nil
+}
+
+func (c *Client) LogOut(ctx context.Context, refreshToken string) error {
+	_, err := c.raw.LogOut(ctx, &auth.LogOutRequest{RefreshToken: refreshToken})
+	return err
+}
+
+// Introspect asks the auth service whether the token is good right now. Unlike
+// Verifier it sees revocations, at the cost of a call.
+func (c *Client) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	resp, err := c.raw.GetToken(ctx, &auth.GetTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	in := &Introspection{
+		Active:           resp.Active,
+		UserID:           resp.Sub,
+		Email:            resp.Email,
+		TokenType:        resp.TokenType,
+		SessionID:        resp.SessionId,
+		Roles:            resp.Roles,
+		Scope:            resp.Scope,
+		RevocationReason: resp.RevocationReason,
+	}
+	if resp.Iat != 0 {
+		in.IssuedAt = time.Unix(resp.Iat, 0)
+	}
+	if resp.Exp != 0 {
+		in.ExpiresAt = time.Unix(resp.Exp, 0)
+	}
+
+	return in, nil
+}
+
+// Keys implements KeySource with the GetJwks RPC.
+func (c *Client) Keys(ctx context.Context) ([]jwtkeys.JWK, error) {
+	resp, err := c.raw.GetJwks(ctx, &auth.EmptyMessage{})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]jwtkeys.JWK, 0, len(resp.Keys))
+	for _, k := range resp.Keys {
+		keys = append(keys, jwtkeys.JWK{
+			Kty: k.Kty,
+			Use: k.Use,
+			Alg: k.Alg,
+			Kid: k.Kid,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,27 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"context"
+	"slices"
+	"strings"
+)
+
+type claimsKey struct{}
+
+// NewContext returns a context carrying the claims of the caller, the way the
+// interceptors pass them to handlers.
+func NewContext(ctx context.Context, claims *models.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the verified claims of the caller.
+func ClaimsFromContext(ctx context.Context) (*models.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*models.Claims)
+	return claims, ok && claims != nil
+}
+
+// HasScope reports whether the token was granted the scope.
+func HasScope(claims *models.Claims, scope string) bool {
+	return slices.Contains(strings.Fields(claims.Scope), scope)
+}
@@ -0,0 +1,86 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+// Fake is an in-memory Authenticator for unit tests. It hands out opaque
+// tokens for whatever claims a test needs:
+//
+//	fake := authclient.NewFake()
+//	token := fake.Issue("user-1", models.RoleCourier)
+//	interceptor := authclient.UnaryServerInterceptor(fake, policy)
+type Fake struct {
+	mu     sync.Mutex
+	tokens map[string]*models.Claims
+}
+
+func NewFake() *Fake {
+	return &Fake{tokens: make(map[string]*models.Claims)}
+}
+
+// Issue returns a token for an access token of the user with the roles.
+func (f *Fake) Issue(userID string, roles ...string) string {
+	now := time.Now()
+	return f.IssueClaims(&models.Claims{
+		UserID:    userID,
+		TokenType: models.TokenTypeAccess,
+		Roles:     roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	})
+}
+
+// IssueClaims returns a token for exactly the given claims.
+func (f *Fake) IssueClaims(claims *models.Claims) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := "fake-" + uuid.NewString()
+	f.tokens[token] = claims
+
+	return token
+}
+
+// Revoke makes the token fail authentication from now on.
+func (f *Fake) Revoke(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.tokens, token)
+}
+
+func (f *Fake) Authenticate(ctx context.Context, token string) (*models.Claims, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	claims, ok := f.tokens[token]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown fake token", ErrInvalidToken)
+	}
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.TokenType != models.TokenTypeAccess {
+		return nil, ErrNotAccessToken
+	}
+
+	return claims, nil
+}
+
+// IncomingContext returns ctx as a server sees a call made with the token,
+// for calling interceptors or handlers directly.
+func (f *Fake) IncomingContext(ctx context.Context, token string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+}
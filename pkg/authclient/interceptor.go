@@ -0,0 +1,132 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"context"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticator turns a bearer token into the claims of the caller. Verifier
+// and Fake implement it.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*models.Claims, error)
+}
+
+// Policy says who may call which method. Methods are full gRPC method names,
+// such as "/order.OrderService/CreateOrder".
+type Policy struct {
+	// Public methods can be called without a token.
+	Public []string
+	// Roles lists the roles a caller needs one of, per method. Methods that
+	// aren't listed only need a valid token.
+	Roles map[string][]string
+	// Scopes lists the scopes the token needs all of, per method.
+	Scopes map[string][]string
+}
+
+// UnaryServerInterceptor authenticates calls, enforces the policy and passes
+// the claims of the caller to handlers, see ClaimsFromContext.
+func UnaryServerInterceptor(authenticator Authenticator, policy Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := policy.authorize(ctx, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls.
+func StreamServerInterceptor(authenticator Authenticator, policy Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := policy.authorize(ss.Context(), authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (p Policy) authorize(ctx context.Context, authenticator Authenticator, method string) (context.Context, error) {
+	if slices.Contains(p.Public, method) {
+		return ctx, nil
+	}
+
+	token, err := BearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := authenticator.Authenticate(ctx, token)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	if roles, ok := p.Roles[method]; ok && !slices.ContainsFunc(roles, claims.HasRole) {
+		return nil, status.Errorf(codes.PermissionDenied, "requires one of the roles %s", strings.Join(roles, ", "))
+	}
+	for _, scope := range p.Scopes[method] {
+		if !HasScope(claims, scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "requires the scope %s", scope)
+		}
+	}
+
+	return NewContext(ctx, claims), nil
+}
+
+// BearerToken returns the token from the "authorization: Bearer <token>" metadata.
+func BearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization metadata must be a bearer token")
+	}
+
+	return token, nil
+}
+
+// WithToken attaches the access token to outgoing calls made with ctx.
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// ServiceTokenHeader carries the token internal services authenticate with
+// when calling methods of the auth service meant for them, like CreateToken
+// and GetToken.
+const ServiceTokenHeader = "x-service-token"
+
+// WithServiceToken attaches the token of the calling service to outgoing calls
+// made with ctx.
+func WithServiceToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ServiceTokenHeader, token)
+}
+
+// serverStream replaces the context of a stream with one carrying the claims.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
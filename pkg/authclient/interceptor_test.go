@@ -0,0 +1,139 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	publicMethod  = "/order.OrderService/ListRestaurants"
+	courierMethod = "/order.OrderService/AcceptOrder"
+	scopedMethod  = "/order.OrderService/CreateOrder"
+	plainMethod   = "/order.OrderService/GetOrder"
+)
+
+var testPolicy = Policy{
+	Public: []string{publicMethod},
+	Roles: map[string][]string{
+		courierMethod: {models.RoleCourier, models.RoleAdmin},
+	},
+	Scopes: map[string][]string{
+		scopedMethod: {"orders:write", "payments"},
+	},
+}
+
+func TestAuthorize(t *testing.T) {
+	fake := NewFake()
+	customer := fake.Issue("user-1", models.RoleCustomer)
+	courier := fake.Issue("user-2", models.RoleCourier)
+	scoped := fake.IssueClaims(&models.Claims{UserID: "user-3", TokenType: models.TokenTypeAccess, Scope: "orders:write payments"})
+	narrow := fake.IssueClaims(&models.Claims{UserID: "user-4", TokenType: models.TokenTypeAccess, Scope: "orders:write"})
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   codes.Code
+	}{
+		{name: "public without token", method: publicMethod, want: codes.OK},
+		{name: "no token", method: plainMethod, want: codes.Unauthenticated},
+		{name: "unknown token", method: plainMethod, token: "nope", want: codes.Unauthenticated},
+		{name: "any valid token", method: plainMethod, token: customer, want: codes.OK},
+		{name: "missing role", method: courierMethod, token: customer, want: codes.PermissionDenied},
+		{name: "one of the roles", method: courierMethod, token: courier, want: codes.OK},
+		{name: "missing scope", method: scopedMethod, token: narrow, want: codes.PermissionDenied},
+		{name: "all scopes", method: scopedMethod, token: scoped, want: codes.OK},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.token != "" {
+			ctx = fake.IncomingContext(ctx, tt.token)
+		}
+
+		_, err := testPolicy.authorize(ctx, fake, tt.method)
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	fake := NewFake()
+	if _, err := BearerToken(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no metadata: got %v, want Unauthenticated", err)
+	}
+
+	got, err := BearerToken(fake.IncomingContext(context.Background(), "abc"))
+	if err != nil || got != "abc" {
+		t.Errorf("bearer: got %q, %v, want abc", got, err)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	fake := NewFake()
+	token := fake.Issue("user-1", models.RoleCourier)
+	interceptor := UnaryServerInterceptor(fake, testPolicy)
+
+	var got *models.Claims
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got, _ = ClaimsFromContext(ctx)
+		return nil, nil
+	}
+
+	ctx := fake.IncomingContext(context.Background(), token)
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: courierMethod}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.UserID != "user-1" {
+		t.Errorf("got claims %+v, want user-1", got)
+	}
+
+	called := false
+	handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	}
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: courierMethod}, handler)
+	if status.Code(err) != codes.Unauthenticated || called {
+		t.Errorf("no token: got %v, handler called %v", err, called)
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	fake := NewFake()
+	token := fake.Issue("user-1", models.RoleCustomer)
+	interceptor := StreamServerInterceptor(fake, testPolicy)
+
+	var got *models.Claims
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		got, _ = ClaimsFromContext(ss.Context())
+		return nil
+	}
+
+	stream := &testStream{ctx: fake.IncomingContext(context.Background(), token)}
+	if err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: plainMethod}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.UserID != "user-1" {
+		t.Errorf("got claims %+v, want user-1", got)
+	}
+
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: courierMethod}, handler)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("missing role: got %v, want PermissionDenied", err)
+	}
+}
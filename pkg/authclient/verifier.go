@@ -0,0 +1,56 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"auth_service/pkg/jwtkeys"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrNotAccessToken = errors.New("not an access token")
+)
+
+// KeySource fetches the public keys tokens are signed with. Client fetches
+// them over gRPC, HTTPKeySource from /.well-known/jwks.json.
+type KeySource interface {
+	Keys(ctx context.Context) ([]jwtkeys.JWK, error)
+}
+
+// HTTPKeySource fetches the JWKS from a URL such as
+// http://auth:8080/.well-known/jwks.json.
+type HTTPKeySource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPKeySource) Keys(ctx context.Context) ([]jwtkeys.JWK, error) {
+	return jwtkeys.FetchJWKS(ctx, h.Client, h.URL)
+}
+
+// Verifier checks access tokens locally, with the public keys of the auth
+// service. It sees expiry but not revocations; use Client.Introspect where a
+// revoked token must be turned away at once.
+type Verifier struct {
+	keys *jwtkeys.RemoteKeys
+}
+
+func NewVerifier(source KeySource) *Verifier {
+	return &Verifier{keys: jwtkeys.NewRemoteKeys(source.Keys)}
+}
+
+// Authenticate verifies an access token and returns its claims.
+func (v *Verifier) Authenticate(ctx context.Context, token string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	if err := v.keys.Parse(ctx, token, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.TokenType != models.TokenTypeAccess {
+		return nil, ErrNotAccessToken
+	}
+
+	return claims, nil
+}
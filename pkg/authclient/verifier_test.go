@@ -0,0 +1,121 @@
+package authclient
+
+import (
+	"auth_service/models"
+	"auth_service/pkg/jwtkeys"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyringSource serves the JWKS of a keyring, as the auth service does.
+type keyringSource struct {
+	keys *jwtkeys.Keyring
+}
+
+func (s keyringSource) Keys(ctx context.Context) ([]jwtkeys.JWK, error) {
+	return s.keys.JWKS().Keys, nil
+}
+
+func newTestKeyring(t *testing.T) *jwtkeys.Keyring {
+	t.Helper()
+	key, err := jwtkeys.GenerateKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jwtkeys.NewKeyring(key)
+}
+
+func testClaims(tokenType string, expiresAt time.Time) *models.Claims {
+	return &models.Claims{
+		UserID:    "user-1",
+		TokenType: tokenType,
+		Roles:     []string{models.RoleCustomer},
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(expiresAt.Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	keys := newTestKeyring(t)
+	unknown := newTestKeyring(t)
+	verifier := NewVerifier(keyringSource{keys: keys})
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		keys   *jwtkeys.Keyring
+		claims *models.Claims
+		want   error
+	}{
+		{name: "access token", keys: keys, claims: testClaims(models.TokenTypeAccess, later)},
+		{name: "expired", keys: keys, claims: testClaims(models.TokenTypeAccess, time.Now().Add(-time.Minute)), want: ErrInvalidToken},
+		{name: "refresh token", keys: keys, claims: testClaims(models.TokenTypeRefresh, later), want: ErrNotAccessToken},
+		{name: "unknown kid", keys: unknown, claims: testClaims(models.TokenTypeAccess, later), want: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		token, err := tt.keys.Sign(tt.claims)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got, err := verifier.Authenticate(context.Background(), token)
+		if tt.want != nil {
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.UserID != "user-1" || !got.HasRole(models.RoleCustomer) {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+}
+
+// TestFakeMatchesVerifier checks that code tested against Fake sees the same
+// outcomes as with the Verifier it stands in for.
+func TestFakeMatchesVerifier(t *testing.T) {
+	keys := newTestKeyring(t)
+	verifier := NewVerifier(keyringSource{keys: keys})
+	fake := NewFake()
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		claims *models.Claims
+	}{
+		{name: "access token", claims: testClaims(models.TokenTypeAccess, later)},
+		{name: "expired", claims: testClaims(models.TokenTypeAccess, time.Now().Add(-time.Minute))},
+		{name: "refresh token", claims: testClaims(models.TokenTypeRefresh, later)},
+	}
+	for _, tt := range tests {
+		signed, err := keys.Sign(tt.claims)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, want := verifier.Authenticate(context.Background(), signed)
+		_, got := fake.Authenticate(context.Background(), fake.IssueClaims(tt.claims))
+
+		if (got == nil) != (want == nil) ||
+			errors.Is(got, ErrInvalidToken) != errors.Is(want, ErrInvalidToken) ||
+			errors.Is(got, ErrNotAccessToken) != errors.Is(want, ErrNotAccessToken) {
+			t.Errorf("%s: fake got %v, verifier got %v", tt.name, got, want)
+		}
+	}
+
+	token := fake.Issue("user-1")
+	fake.Revoke(token)
+	if _, err := fake.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("revoked: got %v, want ErrInvalidToken", err)
+	}
+}
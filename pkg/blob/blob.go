@@ -0,0 +1,64 @@
+// Package blob stores files such as profile pictures, on the local
+// filesystem or in an S3-compatible object store.
+package blob
+
+import (
+	"auth_service/config"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+const keyChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./"
+
+// Storage stores files under slash separated keys like
+// "profile-pictures/<user id>/<name>.jpg".
+type Storage interface {
+	// Put stores data under key, replacing any file there, and returns the
+	// URL it is served at.
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Delete removes the file. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+	// Key returns the key of a URL returned by Put, and false for URLs
+	// that point elsewhere.
+	Key(url string) (string, bool)
+}
+
+func New(cnf config.BlobConfig) (Storage, error) {
+	switch cnf.Backend {
+	case "local", "":
+		return NewLocal(cnf.LocalDir, cnf.PublicURL)
+	case "s3":
+		return NewS3(cnf)
+	default:
+		return nil, fmt.Errorf("unsupported blob backend %q", cnf.Backend)
+	}
+}
+
+// checkKey rejects keys that could escape the storage root or would need
+// escaping in URLs.
+func checkKey(key string) error {
+	if key == "" || strings.Trim(key, keyChars) != "" {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
+
+// keyFromURL strips base from url, see Storage.Key.
+func keyFromURL(base, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, strings.TrimSuffix(base, "/")+"/")
+	if !ok || checkKey(key) != nil {
+		return "", false
+	}
+
+	return key, true
+}
@@ -0,0 +1,108 @@
+// Package clientip works out the address of the end user behind the API
+// gateway. Forwarding headers are only believed when the request comes from
+// a trusted proxy, anyone else could set them to whatever they like.
+package clientip
+
+import (
+	"auth_service/config"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New parses the trusted proxies, given as addresses or CIDR ranges.
+func New(cnf config.GatewayConfig) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range cnf.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+
+	return r, nil
+}
+
+// Resolve returns the address of the end user. peerAddr is the address the
+// request came from, forwardedFor and realIP are the values of the
+// X-Forwarded-For and X-Real-IP headers. Proxies append to X-Forwarded-For,
+// so it is read from the right, skipping trusted proxies.
+func (r *Resolver) Resolve(peerAddr, forwardedFor, realIP string) string {
+	ip := host(peerAddr)
+	if !r.isTrusted(ip) {
+		return ip
+	}
+
+	if forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				break
+			}
+			ip = hop
+			if !r.isTrusted(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if realIP != "" {
+		return strings.TrimSpace(realIP)
+	}
+
+	return ip
+}
+
+func (r *Resolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func host(addr string) string {
+	h, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return h
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the address of the end user.
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext returns the address stored by NewContext.
+func FromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(contextKey{}).(string)
+	return ip, ok
+}
@@ -0,0 +1,29 @@
+package clientip
+
+import (
+	"auth_service/config"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	r, err := New(config.GatewayConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, peer, forwardedFor, realIP, want string
+	}{
+		{"untrusted peer sets headers", "203.0.113.7:5000", "1.2.3.4", "5.6.7.8", "203.0.113.7"},
+		{"trusted gateway", "10.1.2.3:5000", "198.51.100.9", "", "198.51.100.9"},
+		{"spoofed hop before the gateway", "10.1.2.3:5000", "1.2.3.4, 198.51.100.9", "", "198.51.100.9"},
+		{"chain of trusted proxies", "192.168.1.5:5000", "198.51.100.9, 10.0.0.2", "", "198.51.100.9"},
+		{"real ip from gateway", "10.1.2.3:5000", "", "198.51.100.9", "198.51.100.9"},
+		{"no headers", "10.1.2.3:5000", "", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(tt.peer, tt.forwardedFor, tt.realIP); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id writes hashes in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type argon2id struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+func (a *argon2id) hash(password string) (string, error) {
+	salt := make([]byte, a.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.iterations, a.memory, a.parallelism, a.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.memory, a.iterations, a.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2id) owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a *argon2id) verify(encoded, password string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	params := phcParams(parts[3])
+	memory, err1 := strconv.ParseUint(params["m"], 10, 32)
+	iterations, err2 := strconv.ParseUint(params["t"], 10, 32)
+	parallelism, err3 := strconv.ParseUint(params["p"], 10, 8)
+	// argon2.IDKey panics without iterations or threads.
+	if err1 != nil || err2 != nil || err3 != nil || iterations < 1 || parallelism < 1 {
+		return false, false, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, err
+	}
+	// An empty key would match every password.
+	if len(salt) == 0 || len(key) == 0 {
+		return false, false, errors.New("invalid argon2 salt or key")
+	}
+
+	other := argon2.IDKey([]byte(password), salt, uint32(iterations), uint32(memory), uint8(parallelism), uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	outdated := uint32(memory) != a.memory ||
+		uint32(iterations) != a.iterations ||
+		uint8(parallelism) != a.parallelism ||
+		uint32(len(salt)) != a.saltLength ||
+		uint32(len(key)) != a.keyLength
+
+	return true, outdated, nil
+}
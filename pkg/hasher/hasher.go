@@ -0,0 +1,105 @@
+// Package hasher hashes passwords with the configured algorithm and verifies
+// hashes written by any supported algorithm, so that parameters can be raised
+// over time and old hashes upgraded on the next successful login.
+package hasher
+
+import (
+	"auth_service/config"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// algorithm is one hashing scheme. Implementations encode their parameters
+// in the hash, so verification doesn't depend on the current config.
+type algorithm interface {
+	hash(password string) (string, error)
+	// verify reports whether the password matches and whether the hash was
+	// made with parameters other than the current ones.
+	verify(encoded, password string) (ok bool, outdated bool, err error)
+	// owns reports whether the encoded hash was written by this algorithm.
+	owns(encoded string) bool
+}
+
+type Hasher struct {
+	current    algorithm
+	algorithms []algorithm
+	dummyHash  string
+}
+
+func New(cnf config.HasherConfig) (*Hasher, error) {
+	argon := &argon2id{
+		memory:      cnf.Argon2Memory,
+		iterations:  cnf.Argon2Iterations,
+		parallelism: cnf.Argon2Parallelism,
+		saltLength:  cnf.Argon2SaltLength,
+		keyLength:   cnf.Argon2KeyLength,
+	}
+	bc := &bcryptAlgorithm{cost: cnf.BcryptCost}
+
+	h := &Hasher{algorithms: []algorithm{argon, bc}}
+	switch cnf.Algorithm {
+	case AlgorithmArgon2id, "":
+		h.current = argon
+	case AlgorithmBcrypt:
+		h.current = bc
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", cnf.Algorithm)
+	}
+
+	dummy, err := h.current.hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+	h.dummyHash = dummy
+
+	return h, nil
+}
+
+// Hash hashes the password with the current algorithm and parameters.
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.current.hash(password)
+}
+
+// Verify checks the password against a hash made by any supported algorithm.
+// needsRehash is set when the password matched but the hash should be
+// replaced with one from Hash.
+func (h *Hasher) Verify(encoded, password string) (ok bool, needsRehash bool, err error) {
+	for _, alg := range h.algorithms {
+		if !alg.owns(encoded) {
+			continue
+		}
+
+		ok, outdated, err := alg.verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, outdated || alg != h.current, nil
+	}
+
+	return false, false, ErrUnknownFormat
+}
+
+// Dummy spends as long as verifying a real hash. It is used when there is no
+// hash to check, so that response times don't reveal that.
+func (h *Hasher) Dummy(password string) {
+	h.current.verify(h.dummyHash, password)
+}
+
+// phcParams parses the "k=v,k=v" parameter section of a PHC string.
+func phcParams(s string) map[string]string {
+	params := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		params[k] = v
+	}
+	return params
+}
@@ -0,0 +1,157 @@
+package hasher
+
+import (
+	"auth_service/config"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Small parameters keep the tests fast.
+var testConfig = config.HasherConfig{
+	Algorithm:         AlgorithmArgon2id,
+	Argon2Memory:      64,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+	BcryptCost:        bcrypt.MinCost,
+}
+
+func newTestHasher(t *testing.T, cnf config.HasherConfig) *Hasher {
+	t.Helper()
+	h, err := New(cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newTestHasher(t, testConfig)
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$argon2id$v=19$m=64,t=1,p=1$"; !strings.HasPrefix(encoded, want) {
+		t.Errorf("got %s, want prefix %s", encoded, want)
+	}
+
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{password: "correct horse", ok: true},
+		{password: "correct horse ", ok: false},
+		{password: "", ok: false},
+	}
+	for _, tt := range tests {
+		ok, needsRehash, err := h.Verify(encoded, tt.password)
+		if err != nil {
+			t.Errorf("%q: %v", tt.password, err)
+			continue
+		}
+		if ok != tt.ok || needsRehash {
+			t.Errorf("%q: got ok %v, needsRehash %v, want ok %v", tt.password, ok, needsRehash, tt.ok)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := newTestHasher(t, testConfig).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moreMemory := testConfig
+	moreMemory.Argon2Memory = 128
+	moreIterations := testConfig
+	moreIterations.Argon2Iterations = 2
+	longerKey := testConfig
+	longerKey.Argon2KeyLength = 64
+	useBcrypt := testConfig
+	useBcrypt.Algorithm = AlgorithmBcrypt
+	higherCost := useBcrypt
+	higherCost.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name    string
+		cnf     config.HasherConfig
+		encoded string
+		want    bool
+	}{
+		{name: "legacy bcrypt", cnf: testConfig, encoded: string(bcryptHash), want: true},
+		{name: "same argon2 parameters", cnf: testConfig, encoded: argonHash, want: false},
+		{name: "more memory", cnf: moreMemory, encoded: argonHash, want: true},
+		{name: "more iterations", cnf: moreIterations, encoded: argonHash, want: true},
+		{name: "longer key", cnf: longerKey, encoded: argonHash, want: true},
+		{name: "bcrypt is current", cnf: useBcrypt, encoded: string(bcryptHash), want: false},
+		{name: "higher bcrypt cost", cnf: higherCost, encoded: string(bcryptHash), want: true},
+		{name: "argon2 to bcrypt", cnf: useBcrypt, encoded: argonHash, want: true},
+	}
+	for _, tt := range tests {
+		ok, needsRehash, err := newTestHasher(t, tt.cnf).Verify(tt.encoded, "password")
+		if err != nil || !ok {
+			t.Errorf("%s: got ok %v, err %v", tt.name, ok, err)
+			continue
+		}
+		if needsRehash != tt.want {
+			t.Errorf("%s: got needsRehash %v, want %v", tt.name, needsRehash, tt.want)
+		}
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	h := newTestHasher(t, testConfig)
+	encoded, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _, err := h.Verify(string(encoded), "password"); !ok || err != nil {
+		t.Errorf("right password: got ok %v, err %v", ok, err)
+	}
+	if ok, _, err := h.Verify(string(encoded), "wrong"); ok || err != nil {
+		t.Errorf("wrong password: got ok %v, err %v", ok, err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	h := newTestHasher(t, testConfig)
+	salt := "c29tZXNhbHRzb21lc2FsdA"
+	key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "unknown algorithm", encoded: "$scrypt$ln=15,r=8,p=1$" + salt + "$" + key},
+		{name: "missing key", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "wrong version", encoded: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "bad parameters", encoded: "$argon2id$v=19$m=lots,t=1,p=1$" + salt + "$" + key},
+		{name: "no iterations", encoded: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "no threads", encoded: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "bad salt", encoded: "$argon2id$v=19$m=64,t=1,p=1$not base64!$" + key},
+		{name: "empty key", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "truncated bcrypt", encoded: "$2a$04$short"},
+	}
+	for _, tt := range tests {
+		ok, _, err := h.Verify(tt.encoded, "password")
+		if ok || err == nil {
+			t.Errorf("%s: got ok %v, err %v, want an error", tt.name, ok, err)
+		}
+	}
+
+	if _, _, err := h.Verify("plaintext", "plaintext"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("plaintext: got %v, want ErrUnknownFormat", err)
+	}
+}
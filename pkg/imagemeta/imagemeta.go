@@ -0,0 +1,153 @@
+// Package imagemeta removes metadata such as EXIF from uploaded images
+// without re-encoding them, so pixels stay as they were but GPS positions,
+// camera serials and the like don't end up on a public URL.
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrMalformed = errors.New("malformed image")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Strip returns the image without its metadata. contentType is
+// "image/jpeg" or "image/png".
+func Strip(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	default:
+		return nil, fmt.Errorf("unsupported image type %q", contentType)
+	}
+}
+
+// stripJPEG drops the APPn segments but JFIF (APP0), ICC profiles (APP2) and
+// Adobe color info (APP14), and comments. EXIF and XMP live in APP1. Anything
+// after the end of image is dropped too, as files can be hidden there.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	for i := 2; ; {
+		if i+2 > len(data) || data[i] != 0xFF {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+
+		// Fill bytes may precede a marker.
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// Markers without a length.
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if marker == 0xD9 {
+			return append(out, 0xFF, 0xD9), nil
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, ErrMalformed
+		}
+
+		// Entropy coded image data follows the start of scan. Progressive
+		// images have several scans, so carry on with the marker after it.
+		if marker == 0xDA {
+			next := scanEnd(data, end)
+			out = append(out, data[i:next]...)
+			i = next
+			continue
+		}
+
+		if keepJPEGSegment(marker, data[i+4:end]) {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// scanEnd returns where the entropy coded data starting at i ends, which is
+// at the first marker other than a restart marker. 0xFF bytes in the data
+// itself are followed by 0x00.
+func scanEnd(data []byte, i int) int {
+	for ; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		if next := data[i+1]; next != 0x00 && (next < 0xD0 || next > 0xD7) {
+			return i
+		}
+	}
+	return len(data)
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xFE:
+		return false
+	case marker == 0xE0, marker == 0xEE:
+		return true
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker >= 0xE1 && marker <= 0xEF:
+		return false
+	default:
+		return true
+	}
+}
+
+// pngMetadataChunks hold text, EXIF and timestamps. Everything else is
+// needed to render the image, or harmless.
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for i := len(pngSignature); ; {
+		if i+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, ErrMalformed
+		}
+
+		chunkType := string(data[i+4 : i+8])
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[i:end]...)
+		}
+		if chunkType == "IEND" {
+			return out, nil
+		}
+		i = end
+	}
+}
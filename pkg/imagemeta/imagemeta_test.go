@@ -0,0 +1,70 @@
+package imagemeta
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func segment(marker byte, payload string) []byte {
+	n := len(payload) + 2
+	return append([]byte{0xFF, marker, byte(n >> 8), byte(n)}, payload...)
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestStripJPEG(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	eoi := []byte{0xFF, 0xD9}
+	jfif := segment(0xE0, "JFIF\x00\x01\x01")
+	exif := segment(0xE1, "Exif\x00\x00secret")
+	dqt := segment(0xDB, "\x00table")
+	sos := segment(0xDA, "\x01\x01\x00\x00\x3f\x00")
+	// Scan data with a stuffed 0xFF and a restart marker.
+	scan := []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56}
+
+	tests := []struct {
+		name      string
+		in, want  []byte
+		malformed bool
+	}{
+		{
+			name: "drops exif",
+			in:   join(soi, jfif, exif, dqt, sos, scan, eoi),
+			want: join(soi, jfif, dqt, sos, scan, eoi),
+		},
+		{
+			name: "drops data after the end of image",
+			in:   join(soi, jfif, sos, scan, eoi, []byte("PK\x03\x04hidden"), exif),
+			want: join(soi, jfif, sos, scan, eoi),
+		},
+		{
+			name: "drops metadata between progressive scans",
+			in:   join(soi, sos, scan, exif, dqt, sos, scan, eoi),
+			want: join(soi, sos, scan, dqt, sos, scan, eoi),
+		},
+		{
+			name:      "missing end of image",
+			in:        join(soi, sos, scan),
+			malformed: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := Strip("image/jpeg", tt.in)
+		if tt.malformed {
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("%s: got error %v, want ErrMalformed", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, tt.want)
+		}
+	}
+}
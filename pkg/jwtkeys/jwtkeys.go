@@ -0,0 +1,436 @@
+// Package jwtkeys signs and verifies tokens with asymmetric keys and publishes
+// the public halves as a JSON Web Key Set, so that other services can verify
+// tokens without being able to mint them.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKey        = errors.New("unknown signing key")
+	ErrUnsupportedKey    = errors.New("unsupported key type, use RSA or Ed25519")
+	ErrAlgorithmMismatch = errors.New("token algorithm doesn't match its key")
+	ErrNoSigningKey      = errors.New("no active signing key")
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing.
+const minRSABits = 2048
+
+// Key is a signing key, or only the public half of one, which verifies but
+// doesn't sign. Its ID is the RFC 7638 thumbprint of the public key, so it
+// stays the same whoever loads the key.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// NotBefore is when the key starts signing.
+	NotBefore time.Time
+	// RetireAt is when the key stops verifying, zero if it isn't scheduled.
+	RetireAt time.Time
+	private  crypto.Signer
+	public   crypto.PublicKey
+}
+
+// LoadPrivateKey reads a PEM encoded RSA or Ed25519 private key. RSA keys sign
+// with RS256 and Ed25519 keys with EdDSA.
+func LoadPrivateKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %v", err)
+	}
+
+	return ParsePrivateKey(data)
+}
+
+func ParsePrivateKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	key, err := newKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = signer
+
+	return key, nil
+}
+
+// LoadDir reads the private keys of the PEM files in dir.
+func LoadDir(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// ParsePublicKey reads a PEM encoded public key, as written by
+// MarshalPublicPEM. The key verifies tokens but can't sign them.
+func ParsePublicKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	return newKey(public)
+}
+
+func newKey(public crypto.PublicKey) (*Key, error) {
+	key := &Key{public: public}
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	key.ID = key.JWK().thumbprint()
+
+	return key, nil
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.public
+}
+
+// CanSign reports whether the private half of the key was loaded.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// JWK is a public key in the JSON Web Key format. RSA keys use N and E,
+// Ed25519 keys use Crv and X.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{Use: "sig", Alg: k.Method.Alg(), Kid: k.ID}
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(pub)
+	}
+
+	return jwk
+}
+
+// PublicKey decodes the key, and returns it with the signing method its
+// "alg" names, so that verifiers don't need the private half.
+func (j JWK) PublicKey() (crypto.PublicKey, jwt.SigningMethod, error) {
+	switch {
+	// Some issuers leave out "alg"; their RSA keys are for RS256.
+	case j.Kty == "RSA" && (j.Alg == jwt.SigningMethodRS256.Alg() || j.Alg == ""):
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid modulus of key %s: %v", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid exponent of key %s: %v", j.Kid, err)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits {
+			return nil, nil, fmt.Errorf("RSA key %s must be at least %d bits", j.Kid, minRSABits)
+		}
+		return pub, jwt.SigningMethodRS256, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519" && j.Alg == jwt.SigningMethodEdDSA.Alg():
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("invalid Ed25519 key %s", j.Kid)
+		}
+		return ed25519.PublicKey(x), jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("key %s: %w", j.Kid, ErrUnsupportedKey)
+	}
+}
+
+// thumbprint hashes the required members of the key in lexical order, as
+// RFC 7638 describes.
+func (j JWK) thumbprint() string {
+	var members any
+	if j.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return encode(sum[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// GenerateKey creates a new key for the algorithm, "RS256" or "EdDSA".
+func GenerateKey(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, use RS256 or EdDSA", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	data, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}))
+}
+
+// MarshalPEM encodes the private key as PKCS #8.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	data, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), nil
+}
+
+// MarshalPublicPEM encodes the public key as PKIX.
+func (k *Key) MarshalPublicPEM() ([]byte, error) {
+	data, err := x509.MarshalPKIXPublicKey(k.public)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}), nil
+}
+
+func (k *Key) active(now time.Time) bool {
+	return !now.Before(k.NotBefore) && !k.retired(now)
+}
+
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// Keyring signs new tokens with its newest active key and verifies tokens with
+// the key named by the "kid" header, as long as that key isn't retired. Keys
+// are published in the JWKS before they become active, so that verifiers
+// caching the set already know them when the first token arrives.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+func NewKeyring(keys ...*Key) *Keyring {
+	return &Keyring{keys: keys}
+}
+
+// Replace swaps the keys, e.g. after they were reloaded from storage.
+func (r *Keyring) Replace(keys []*Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = keys
+}
+
+// signingKey returns the newest active key. Keys that are scheduled for
+// retirement only sign when there is no other choice.
+func (r *Keyring) signingKey(now time.Time) (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var newest, newestRetiring *Key
+	for _, key := range r.keys {
+		if !key.active(now) || !key.CanSign() {
+			continue
+		}
+		best := &newest
+		if !key.RetireAt.IsZero() {
+			best = &newestRetiring
+		}
+		if *best == nil || key.NotBefore.After((*best).NotBefore) {
+			*best = key
+		}
+	}
+	if newest == nil {
+		newest = newestRetiring
+	}
+	if newest == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return newest, nil
+}
+
+func (r *Keyring) verificationKey(kid string, now time.Time) (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.ID == kid && !key.retired(now) {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// SigningKey returns the key that signs now, or ErrNoSigningKey if there is
+// none, e.g. because no active key has its private half loaded.
+func (r *Keyring) SigningKey() (*Key, error) {
+	return r.signingKey(time.Now())
+}
+
+// Sign signs the claims with the signing key and names it in the "kid" header.
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key, err := r.signingKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.private)
+}
+
+// Parse verifies the token and decodes it into claims. Only the algorithm of
+// the key named by the token is accepted, so a token can't pick a weaker one.
+func (r *Keyring) Parse(tokenStr string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := r.verificationKey(kid, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+
+		return key.Public(), nil
+	})
+
+	return err
+}
+
+// JWKS returns the public keys that aren't retired, including the ones that
+// don't sign yet.
+func (r *Keyring) JWKS() JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	jwks := JWKS{Keys: make([]JWK, 0, len(r.keys))}
+	for _, key := range r.keys {
+		if !key.retired(now) {
+			jwks.Keys = append(jwks.Keys, key.JWK())
+		}
+	}
+
+	return jwks
+}
+
+// Algorithms returns the algorithms of the keys that sign now, or did and
+// haven't been retired. Keys published ahead of their start are left out, as
+// no token is signed with them yet.
+func (r *Keyring) Algorithms() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var algs []string
+	for _, key := range r.keys {
+		if key.active(now) && !slices.Contains(algs, key.Method.Alg()) {
+			algs = append(algs, key.Method.Alg())
+		}
+	}
+
+	return algs
+}
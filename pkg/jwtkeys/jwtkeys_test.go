@@ -0,0 +1,137 @@
+package jwtkeys
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func newTestKey(t *testing.T, algorithm string, notBefore, retireAt time.Time) *Key {
+	t.Helper()
+	key, err := GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.NotBefore, key.RetireAt = notBefore, retireAt
+	return key
+}
+
+func TestAlgorithms(t *testing.T) {
+	now := time.Now()
+	r := NewKeyring(
+		newTestKey(t, "RS256", now.Add(-time.Hour), now.Add(time.Hour)),
+		newTestKey(t, "EdDSA", now.Add(time.Hour), time.Time{}),
+	)
+
+	if got, want := r.Algorithms(), []string{"RS256"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := len(r.JWKS().Keys); got != 2 {
+		t.Errorf("JWKS has %d keys, want both", got)
+	}
+}
+
+func TestSignAndParse(t *testing.T) {
+	now := time.Now()
+	old := newTestKey(t, "RS256", now.Add(-2*time.Hour), time.Time{})
+	current := newTestKey(t, "EdDSA", now.Add(-time.Hour), time.Time{})
+	next := newTestKey(t, "RS256", now.Add(time.Hour), time.Time{})
+	r := NewKeyring(old, current, next)
+
+	token, err := r.Sign(jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims jwt.RegisteredClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return current.Public(), nil
+	})
+	if err != nil || parsed.Header["kid"] != current.ID {
+		t.Fatalf("token not signed by the newest active key: kid %v, %v", parsed.Header["kid"], err)
+	}
+
+	claims = jwt.RegisteredClaims{}
+	if err := r.Parse(token, &claims); err != nil || claims.Subject != "user" {
+		t.Fatalf("Parse: %v, subject %q", err, claims.Subject)
+	}
+
+	// Tokens of the older key keep verifying until it is retired.
+	oldToken := signWith(t, old, old.ID)
+	if err := r.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("token of older key: %v", err)
+	}
+	old.RetireAt = now.Add(-time.Minute)
+	if err := r.Parse(oldToken, &jwt.RegisteredClaims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of retired key: got %v, want ErrUnknownKey", err)
+	}
+
+	stranger := newTestKey(t, "EdDSA", now.Add(-time.Hour), time.Time{})
+	if err := r.Parse(signWith(t, stranger, stranger.ID), &jwt.RegisteredClaims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of unknown kid: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestParseRejectsOtherAlgorithm(t *testing.T) {
+	now := time.Now()
+	rsaKey := newTestKey(t, "RS256", now.Add(-time.Hour), time.Time{})
+	r := NewKeyring(rsaKey)
+
+	// An EdDSA token naming the RSA key.
+	edKey := newTestKey(t, "EdDSA", now.Add(-time.Hour), time.Time{})
+	if err := r.Parse(signWith(t, edKey, rsaKey.ID), &jwt.RegisteredClaims{}); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("EdDSA token: got %v, want ErrAlgorithmMismatch", err)
+	}
+
+	// An HMAC token keyed with the public key, the classic confusion.
+	public, err := rsaKey.MarshalPublicPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "admin"})
+	token.Header["kid"] = rsaKey.ID
+	signed, err := token.SignedString(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Parse(signed, &jwt.RegisteredClaims{}); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("HS256 token: got %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestPublicKeyOnlyVerifies(t *testing.T) {
+	key := newTestKey(t, "RS256", time.Now().Add(-time.Hour), time.Time{})
+	data, err := key.MarshalPublicPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePublicKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.ID != key.ID || public.CanSign() {
+		t.Fatalf("public key: id %s, can sign %v", public.ID, public.CanSign())
+	}
+
+	r := NewKeyring(public)
+	if _, err := r.Sign(jwt.RegisteredClaims{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Sign: got %v, want ErrNoSigningKey", err)
+	}
+	if err := r.Parse(signWith(t, key, key.ID), &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+}
+
+func signWith(t *testing.T, key *Key, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, jwt.RegisteredClaims{Subject: "user"})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
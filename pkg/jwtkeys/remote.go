@@ -0,0 +1,142 @@
+package jwtkeys
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// remoteKeysTTL is how long fetched keys are used before they are
+	// fetched again.
+	remoteKeysTTL = 5 * time.Minute
+	// minRefetch limits fetches for tokens signed with an unknown key, so
+	// that garbage tokens can't make every call hit the key's owner.
+	minRefetch = 30 * time.Second
+)
+
+type publicKey struct {
+	key    crypto.PublicKey
+	method jwt.SigningMethod
+}
+
+// RemoteKeys verifies tokens with the public keys of another issuer, such as
+// this service for its clients or an OpenID provider for this service.
+type RemoteKeys struct {
+	fetch func(ctx context.Context) ([]JWK, error)
+
+	mu        sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// NewRemoteKeys caches the keys returned by fetch.
+func NewRemoteKeys(fetch func(ctx context.Context) ([]JWK, error)) *RemoteKeys {
+	return &RemoteKeys{fetch: fetch}
+}
+
+// Parse verifies the token and decodes it into claims, like Keyring.Parse.
+func (r *RemoteKeys) Parse(ctx context.Context, tokenStr string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := r.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+
+		return key.key, nil
+	})
+
+	return err
+}
+
+// key returns the key with the given ID, fetching the keys again when they
+// are stale or don't include it, which happens right after a key rotation.
+func (r *RemoteKeys) key(ctx context.Context, kid string) (publicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[kid]
+	fetched := !r.fetchedAt.IsZero()
+	age := time.Since(r.fetchedAt)
+	if ok && fetched && age < remoteKeysTTL {
+		return key, nil
+	}
+	if !ok && fetched && age < minRefetch {
+		return publicKey{}, ErrUnknownKey
+	}
+
+	if err := r.refresh(ctx); err != nil {
+		// Keep using the keys we have while the issuer is unreachable.
+		log.Println("Failed to refresh jwks: ", err)
+		r.fetchedAt = time.Now()
+	}
+
+	key, ok = r.keys[kid]
+	if !ok {
+		return publicKey{}, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func (r *RemoteKeys) refresh(ctx context.Context) error {
+	jwks, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]publicKey, len(jwks))
+	for _, jwk := range jwks {
+		key, method, err := jwk.PublicKey()
+		if err != nil {
+			log.Println("Skipping jwk: ", err)
+			continue
+		}
+		keys[jwk.Kid] = publicKey{key: key, method: method}
+	}
+	r.keys = keys
+	r.fetchedAt = time.Now()
+
+	return nil
+}
+
+// FetchJWKS gets the key set served at url. A nil client gets a default one
+// with a timeout.
+func FetchJWKS(ctx context.Context, client *http.Client, url string) ([]JWK, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: %s", resp.Status)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %v", err)
+	}
+
+	return jwks.Keys, nil
+}
@@ -0,0 +1,130 @@
+// Package oidc verifies ID tokens issued by external OpenID Connect
+// providers, such as Google and Apple, for logging in with them.
+package oidc
+
+import (
+	"auth_service/config"
+	"auth_service/pkg/jwtkeys"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce doesn't match")
+)
+
+// IDToken holds what a verified ID token says about the user.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	ExpiresAt     time.Time
+}
+
+// Provider verifies the ID tokens of one provider.
+type Provider struct {
+	issuers   []string
+	audiences []string
+	keys      *jwtkeys.RemoteKeys
+}
+
+func NewProvider(cnf config.OIDCProviderConfig) *Provider {
+	return &Provider{
+		issuers:   cnf.Issuers,
+		audiences: cnf.ClientIDs,
+		keys: jwtkeys.NewRemoteKeys(func(ctx context.Context) ([]jwtkeys.JWK, error) {
+			return jwtkeys.FetchJWKS(ctx, nil, cnf.JWKSURL)
+		}),
+	}
+}
+
+// NewProviders creates a Provider for each configured one.
+func NewProviders(cnf map[string]config.OIDCProviderConfig) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cnf))
+	for name, c := range cnf {
+		providers[name] = NewProvider(c)
+	}
+
+	return providers
+}
+
+type idTokenClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Nonce         string   `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// Verify checks the signature, expiry, issuer and audience of the token, and
+// that it carries the nonce the client generated for this login. The nonce
+// may also be in the token as its SHA-256 hex digest, which is what Sign in
+// with Apple apps pass to Apple.
+func (p *Provider) Verify(ctx context.Context, rawToken, nonce string) (*IDToken, error) {
+	claims := &idTokenClaims{}
+	if err := p.keys.Parse(ctx, rawToken, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if !slices.Contains(p.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !slices.ContainsFunc(p.audiences, func(aud string) bool { return claims.VerifyAudience(aud, true) }) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: missing sub or exp", ErrInvalidIDToken)
+	}
+
+	if nonce == "" || !(equal(claims.Nonce, nonce) || equal(claims.Nonce, hashNonce(nonce))) {
+		return nil, ErrNonceMismatch
+	}
+
+	return &IDToken{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		ExpiresAt:     claims.ExpiresAt.Time,
+	}, nil
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// flexBool decodes both true and "true"; Apple sends booleans as strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(v == "true")
+	default:
+		*b = false
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func newTestIssuer(t *testing.T) *FakeIssuer {
+	t.Helper()
+	issuer, err := NewFakeIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+func testClaims(issuer, audience, nonce string, expiresAt time.Time) idTokenClaims {
+	return idTokenClaims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(expiresAt.Add(-10 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+	provider := NewProvider(issuer.Config("app"))
+	later := time.Now().Add(10 * time.Minute)
+
+	tests := []struct {
+		name   string
+		signer *FakeIssuer
+		claims idTokenClaims
+		nonce  string
+		want   error
+	}{
+		{
+			name:   "valid",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "app", "nonce", later),
+			nonce:  "nonce",
+		},
+		{
+			name:   "hashed nonce",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "app", hashNonce("nonce"), later),
+			nonce:  "nonce",
+		},
+		{
+			name:   "wrong issuer",
+			signer: issuer,
+			claims: testClaims(other.Issuer(), "app", "nonce", later),
+			nonce:  "nonce",
+			want:   ErrInvalidIDToken,
+		},
+		{
+			name:   "wrong audience",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "other-app", "nonce", later),
+			nonce:  "nonce",
+			want:   ErrInvalidIDToken,
+		},
+		{
+			name:   "expired",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "app", "nonce", time.Now().Add(-time.Minute)),
+			nonce:  "nonce",
+			want:   ErrInvalidIDToken,
+		},
+		{
+			name:   "wrong nonce",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "app", "nonce", later),
+			nonce:  "other-nonce",
+			want:   ErrNonceMismatch,
+		},
+		{
+			name:   "no nonce",
+			signer: issuer,
+			claims: testClaims(issuer.Issuer(), "app", "", later),
+			want:   ErrNonceMismatch,
+		},
+		{
+			name:   "key not in jwks",
+			signer: other,
+			claims: testClaims(issuer.Issuer(), "app", "nonce", later),
+			nonce:  "nonce",
+			want:   ErrInvalidIDToken,
+		},
+	}
+	for _, tt := range tests {
+		token, err := tt.signer.Sign(tt.claims)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got, err := provider.Verify(context.Background(), token, tt.nonce)
+		if tt.want != nil {
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Subject != "user-1" || got.Email != "user@example.com" || !got.EmailVerified {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	tests := []struct {
+		in   string
+		want flexBool
+	}{
+		{in: `true`, want: true},
+		{in: `"true"`, want: true},
+		{in: `"false"`, want: false},
+		{in: `1`, want: false},
+	}
+	for _, tt := range tests {
+		var got flexBool
+		if err := got.UnmarshalJSON([]byte(tt.in)); err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
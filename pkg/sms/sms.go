@@ -0,0 +1,79 @@
+// Package sms sends text messages. Only development backends exist so far;
+// a provider is added by implementing Sender and choosing it in New.
+package sms
+
+import (
+	"auth_service/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Sender interface {
+	// Send delivers body to the E.164 phone number to.
+	Send(ctx context.Context, to, body string) error
+}
+
+func New(cnf config.SmsConfig) (Sender, error) {
+	switch cnf.Backend {
+	case "log", "":
+		log.Println("SMS messages, login codes included, are written to the log; configure SMS_BACKEND for production")
+		return LogSender{}, nil
+	case "file":
+		return NewFileSender(cnf.File), nil
+	default:
+		return nil, fmt.Errorf("unsupported sms backend %q", cnf.Backend)
+	}
+}
+
+// LogSender writes messages to the log instead of sending them.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, to, body string) error {
+	log.Printf("SMS to %s: %s", to, body)
+	return nil
+}
+
+// Message is a line written by FileSender.
+type Message struct {
+	To     string    `json:"to"`
+	Body   string    `json:"body"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// FileSender appends messages to a file as JSON lines, so that tests can
+// read the codes that were sent.
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (f *FileSender) Send(ctx context.Context, to, body string) error {
+	data, err := json.Marshal(Message{To: to, Body: body, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open sms file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write sms: %v", err)
+	}
+
+	return nil
+}
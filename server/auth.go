@@ -3,21 +3,50 @@ package server
 import (
 	"auth_service/config"
 	"auth_service/genproto/auth"
+	"auth_service/genproto/user"
+	"auth_service/pkg/clientip"
 	"auth_service/service"
+	"errors"
 	"fmt"
 	"net"
 
 	"google.golang.org/grpc"
 )
 
-func Run(s interface{}, cnf config.Config) error {
-	server := grpc.NewServer()
+// Run serves the given services on one gRPC server. The AuthService must be
+// among them, it authenticates the calls to all of them.
+func Run(cnf config.Config, services ...interface{}) error {
+	var authService *service.AuthService
+	for _, s := range services {
+		if ser, ok := s.(*service.AuthService); ok {
+			authService = ser
+		}
+	}
+	if authService == nil {
+		return errors.New("auth service is required")
+	}
+
+	resolver, err := clientip.New(cnf.Gateway)
+	if err != nil {
+		return err
+	}
+
+	clientIP := &clientIPInterceptor{resolver: resolver}
+	interceptor := &authInterceptor{authenticator: authService, cnf: cnf.Internal}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(clientIP.unary, interceptor.unary),
+		grpc.ChainStreamInterceptor(clientIP.stream, interceptor.stream),
+	)
 
-	switch ser := s.(type) {
-	case *service.AuthService:
-		auth.RegisterAuthServiceServer(server, ser)
-	default:
-		return fmt.Errorf("unsupported service type: %T", ser)
+	for _, s := range services {
+		switch ser := s.(type) {
+		case *service.AuthService:
+			auth.RegisterAuthServiceServer(server, ser)
+		case *service.UserService:
+			user.RegisterUserServiceServer(server, ser)
+		default:
+			return fmt.Errorf("unsupported service type: %T", ser)
+		}
 	}
 
 	lst, err := net.Listen("tcp", cnf.AuthServer.Host+":"+cnf.AuthServer.Port)
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"auth_service/config"
+	"net/http"
+	"time"
+)
+
+// RunHTTP serves handler on the HTTP address from cnf.Server.
+func RunHTTP(handler http.Handler, cnf config.Config) error {
+	server := &http.Server{
+		Addr:              cnf.Server.Host + ":" + cnf.Server.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return server.ListenAndServe()
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"auth_service/config"
+	"auth_service/models"
+	"auth_service/pkg/authclient"
+	"auth_service/pkg/clientip"
+	"context"
+	"crypto/subtle"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authInterceptor enforces authPolicy before handlers run. Callers with an
+// access token get its claims in the context, see authclient.ClaimsFromContext.
+type authInterceptor struct {
+	authenticator authclient.Authenticator
+	cnf           config.InternalConfig
+}
+
+func (i *authInterceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := i.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (i *authInterceptor) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func (i *authInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	access, ok := authPolicy[method]
+	if !ok {
+		log.Printf("Refused %s, it has no auth policy", method)
+		return nil, status.Error(codes.PermissionDenied, "method not allowed")
+	}
+
+	switch access {
+	case accessPublic:
+		return ctx, nil
+	case accessInternal:
+		if !i.internalService(ctx) {
+			return nil, status.Error(codes.PermissionDenied, "internal service credentials required")
+		}
+		return ctx, nil
+	}
+
+	token, err := authclient.BearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := i.authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if access == accessAdmin && !claims.HasRole(models.RoleAdmin) {
+		return nil, status.Error(codes.PermissionDenied, "admin access required")
+	}
+
+	return authclient.NewContext(ctx, claims), nil
+}
+
+// internalService reports whether the caller sent the token of a known service.
+func (i *authInterceptor) internalService(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authclient.ServiceTokenHeader)
+	if len(values) == 0 || values[0] == "" {
+		return false
+	}
+
+	for _, token := range i.cnf.ServiceTokens {
+		if subtle.ConstantTimeCompare([]byte(values[0]), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIPInterceptor resolves the address of the end user once per call,
+// see clientip.Resolver.
+type clientIPInterceptor struct {
+	resolver *clientip.Resolver
+}
+
+func (c *clientIPInterceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(c.withClientIP(ctx), req)
+}
+
+func (c *clientIPInterceptor) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &serverStream{ServerStream: ss, ctx: c.withClientIP(ss.Context())})
+}
+
+func (c *clientIPInterceptor) withClientIP(ctx context.Context) context.Context {
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return strings.Join(v, ",")
+		}
+		return ""
+	}
+
+	return clientip.NewContext(ctx, c.resolver.Resolve(peerAddr, header("x-forwarded-for"), header("x-real-ip")))
+}
+
+// serverStream replaces the context of a stream, e.g. with one carrying the
+// claims.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
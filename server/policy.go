@@ -0,0 +1,64 @@
+package server
+
+// Who may call a method.
+const (
+	// accessPublic methods need no credentials.
+	accessPublic = iota
+	// accessUser methods need a valid access token.
+	accessUser
+	// accessInternal methods are for other services of the platform, which
+	// authenticate with their service token.
+	accessInternal
+	// accessAdmin methods need an access token with the admin role.
+	accessAdmin
+)
+
+// authPolicy lists every method the server serves. Methods missing from it
+// are refused, so a new RPC can't go out unprotected by accident.
+var authPolicy = map[string]int{
+	"/auth.AuthService/Register":             accessPublic,
+	"/auth.AuthService/Login":                accessPublic,
+	"/auth.AuthService/LogOut":               accessPublic,
+	"/auth.AuthService/RefreshToken":         accessPublic,
+	"/auth.AuthService/VerifyEmail":          accessPublic,
+	"/auth.AuthService/VerifyMfa":            accessPublic,
+	"/auth.AuthService/RequestPasswordReset": accessPublic,
+	"/auth.AuthService/ResetPassword":        accessPublic,
+	"/auth.AuthService/GetJwks":              accessPublic,
+	"/auth.AuthService/StartPhoneLogin":      accessPublic,
+	"/auth.AuthService/CompletePhoneLogin":   accessPublic,
+	"/auth.AuthService/RequestMagicLink":     accessPublic,
+	"/auth.AuthService/ConsumeMagicLink":     accessPublic,
+	"/auth.AuthService/CreateIdTokenNonce":   accessPublic,
+	"/auth.AuthService/LoginWithIdToken":     accessPublic,
+
+	"/auth.AuthService/EnableTwoFactor":         accessUser,
+	"/auth.AuthService/ConfirmTwoFactor":        accessUser,
+	"/auth.AuthService/DisableTwoFactor":        accessUser,
+	"/auth.AuthService/RegenerateRecoveryCodes": accessUser,
+	"/auth.AuthService/GetRecoveryCodesStatus":  accessUser,
+	"/auth.AuthService/ChangePassword":          accessUser,
+	"/auth.AuthService/ListSessions":            accessUser,
+	"/auth.AuthService/RevokeSession":           accessUser,
+	"/auth.AuthService/LogOutAll":               accessUser,
+	"/auth.AuthService/RevokeConsent":           accessUser,
+
+	"/auth.AuthService/CreateToken":  accessInternal,
+	"/auth.AuthService/GetToken":     accessInternal,
+	"/auth.AuthService/RevokeToken":  accessInternal,
+	"/auth.AuthService/CheckByEmail": accessInternal,
+
+	"/auth.AuthService/AdminLogOutAll": accessAdmin,
+	"/auth.AuthService/GrantRole":      accessAdmin,
+	"/auth.AuthService/RevokeRole":     accessAdmin,
+	"/auth.AuthService/ListUserRoles":  accessAdmin,
+
+	"/auth.AuthService/RegisterOAuthClient": accessAdmin,
+
+	// Users reach their own profile, admins anyone's; see UserService.
+	"/user.UserService/GetUserProfile":       accessUser,
+	"/user.UserService/UpdateUserProfile":    accessUser,
+	"/user.UserService/GetUserSettings":      accessUser,
+	"/user.UserService/UpdateUserSettings":   accessUser,
+	"/user.UserService/UploadProfilePicture": accessUser,
+}
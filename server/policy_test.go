@@ -0,0 +1,30 @@
+package server
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/genproto/user"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// Every method the server registers must have a policy entry, or the
+// interceptor refuses it.
+func TestAuthPolicyCoversAllMethods(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{auth.AuthService_ServiceDesc, user.UserService_ServiceDesc} {
+		var methods []string
+		for _, m := range desc.Methods {
+			methods = append(methods, m.MethodName)
+		}
+		for _, s := range desc.Streams {
+			methods = append(methods, s.StreamName)
+		}
+
+		for _, name := range methods {
+			method := "/" + desc.ServiceName + "/" + name
+			if _, ok := authPolicy[method]; !ok {
+				t.Errorf("%s has no auth policy", method)
+			}
+		}
+	}
+}
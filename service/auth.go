@@ -4,32 +4,77 @@ import (
 	"auth_service/config"
 	"auth_service/genproto/auth"
 	"auth_service/models"
+	"auth_service/pkg/hasher"
+	"auth_service/pkg/jwtkeys"
+	"auth_service/pkg/oidc"
+	"auth_service/pkg/sms"
+	"auth_service/service/passwordpolicy"
 	"auth_service/storage/cache"
 	"auth_service/storage/postgres"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type AuthService struct {
-	user        *postgres.UserManagementImpl
-	emailsender *EmailSender
-	cnf         *config.Config
-	tokenCache  *cache.TokenCache
+	user           *postgres.UserManagementImpl
+	emailsender    *EmailSender
+	cnf            *config.Config
+	tokenCache     *cache.TokenCache
+	loginAttempts  *cache.LoginAttemptCache
+	twoFactor      *postgres.TwoFactorImpl
+	mfaCache       *cache.MfaCache
+	recoveryCodes  *postgres.RecoveryCodeImpl
+	securityEvents *postgres.SecurityEventImpl
+	passwordResets *postgres.PasswordResetImpl
+	tokens         *postgres.TokenImpl
+	passwordPolicy *passwordpolicy.Policy
+	hasher         *hasher.Hasher
+	keys           *jwtkeys.Keyring
+	roles          *postgres.RoleImpl
+	scopes         *postgres.ScopeImpl
+	settings       *postgres.UserSettingsImpl
+	phoneCodes     *cache.PhoneCodeCache
+	sms            sms.Sender
+	identities     *postgres.IdentityImpl
+	oidcProviders  map[string]*oidc.Provider
+	clients        *postgres.OAuthClientImpl
+	consents       *postgres.ConsentImpl
 	auth.UnimplementedAuthServiceServer
 }
 
-func NewAuthService(user *postgres.UserManagementImpl, emailsender *EmailSender, cnf *config.Config, tokenCacher *cache.TokenCache) *AuthService {
+func NewAuthService(user *postgres.UserManagementImpl, emailsender *EmailSender, cnf *config.Config, tokenCacher *cache.TokenCache, loginAttempts *cache.LoginAttemptCache, twoFactor *postgres.TwoFactorImpl, mfaCache *cache.MfaCache, recoveryCodes *postgres.RecoveryCodeImpl, securityEvents *postgres.SecurityEventImpl, passwordResets *postgres.PasswordResetImpl, tokens *postgres.TokenImpl, passwordPolicy *passwordpolicy.Policy, hasher *hasher.Hasher, keys *jwtkeys.Keyring, roles *postgres.RoleImpl, scopes *postgres.ScopeImpl, settings *postgres.UserSettingsImpl, phoneCodes *cache.PhoneCodeCache, smsSender sms.Sender, identities *postgres.IdentityImpl, oidcProviders map[string]*oidc.Provider, clients *postgres.OAuthClientImpl, consents *postgres.ConsentImpl) *AuthService {
 	return &AuthService{
-		user:        user,
-		emailsender: emailsender,
-		cnf:         cnf,
-		tokenCache:  tokenCacher,
+		user:           user,
+		emailsender:    emailsender,
+		cnf:            cnf,
+		tokenCache:     tokenCacher,
+		loginAttempts:  loginAttempts,
+		twoFactor:      twoFactor,
+		mfaCache:       mfaCache,
+		recoveryCodes:  recoveryCodes,
+		securityEvents: securityEvents,
+		passwordResets: passwordResets,
+		tokens:         tokens,
+		passwordPolicy: passwordPolicy,
+		hasher:         hasher,
+		keys:           keys,
+		roles:          roles,
+		scopes:         scopes,
+		settings:       settings,
+		phoneCodes:     phoneCodes,
+		sms:            smsSender,
+		identities:     identities,
+		oidcProviders:  oidcProviders,
+		clients:        clients,
+		consents:       consents,
 	}
 }
 
@@ -47,28 +92,91 @@ func (a *AuthService) CheckByEmail(ctx context.Context, req *auth.CheckByEmailRe
 }
 
 func (a *AuthService) Login(ctx context.Context, req *auth.LoginRequest) (*auth.LoginResponse, error) {
-	user, err := a.user.GetByEmail(ctx, req.Email)
+	attempt, err := a.reserveLoginAttempt(ctx, cache.EmailSubject(req.Email), clientIP(ctx))
 	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Println("Unexpected error has occured: ", err)
 		return nil, err
 	}
-	if err == sql.ErrNoRows && user == nil {
-		log.Println("No user foun by this email: ", req.Email)
-		return nil, fmt.Errorf("notFound")
+
+	if user == nil {
+		log.Println("No user found by this email: ", req.Email)
+		// Spend the same time as a real check so that response times
+		// don't reveal which emails are registered.
+		a.hasher.Dummy(req.Password)
+		return nil, a.loginFailed(ctx, attempt)
 	}
 
-	tokens, err := a.CreateToken(ctx, &auth.CreateTokenRequest{UserId: user.UserId})
+	ok, needsRehash := a.comparePassword(user.HashedPassword, req.Password)
+	if !ok {
+		return nil, a.loginFailed(ctx, attempt)
+	}
+	if needsRehash {
+		a.rehashPassword(ctx, user.UserId, req.Password)
+	}
 
+	resp, err := a.completeLogin(ctx, user.UserId, req.DeviceName, req.ClientId, req.Scopes)
 	if err != nil {
 		return nil, err
 	}
 
-	return &auth.LoginResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+	// With two-factor authentication VerifyMfa resets the attempts.
+	if resp.MfaRequired {
+		a.loginPending(ctx, attempt)
+	} else {
+		a.loginSucceeded(ctx, attempt)
+	}
+
+	return resp, nil
 }
 
-func (a *AuthService) LogOut(ctx context.Context, req *auth.LogOutRequest) (*auth.EmptyMessage, error) {
-	err := a.tokenCache.RevokeToken(ctx, &cache.RevokeTokens{RefreshToken: req.RefreshToken})
+// completeLogin issues tokens to a user who proved their first factor, or a
+// challenge for the second one if they have two-factor authentication.
+func (a *AuthService) completeLogin(ctx context.Context, userID, deviceName, clientID string, scopes []string) (*auth.LoginResponse, error) {
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("Failed to get two factor auth: ", err)
+		return nil, err
+	}
+	// Scopes are checked before a challenge is handed out, so that a second
+	// factor isn't asked for a login that is going to fail anyway.
+	if _, err := a.grantScopes(ctx, userID, clientID, scopes); err != nil {
+		return nil, err
+	}
+
+	if twoFactor != nil && twoFactor.Enabled {
+		return a.startMfaChallenge(ctx, &cache.MfaChallenge{
+			UserID:   userID,
+			ClientID: clientID,
+			Scopes:   scopes,
+		})
+	}
+
+	tokens, err := a.CreateToken(ctx, &auth.CreateTokenRequest{
+		UserId:     userID,
+		DeviceName: deviceName,
+		Scopes:     scopes,
+		ClientId:   clientID,
+	})
+
 	if err != nil {
+		return nil, err
+	}
+
+	return &auth.LoginResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken, Scope: tokens.Scope}, nil
+}
+
+func (a *AuthService) LogOut(ctx context.Context, req *auth.LogOutRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.extractClaims(req.RefreshToken)
+	if err != nil || claims.FamilyID == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
+	}
+
+	if err := a.revokeFamily(ctx, claims.FamilyID, models.RevokeReasonLogout); err != nil {
 		log.Println("Token Revocation failed: ", err)
 		return nil, err
 	}
@@ -76,40 +184,120 @@ func (a *AuthService) LogOut(ctx context.Context, req *auth.LogOutRequest) (*aut
 	return &auth.EmptyMessage{}, nil
 }
 
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// Each refresh token can be used once; presenting one that was already
+// rotated means it was copied, so the whole family is revoked.
 func (a *AuthService) RefreshToken(ctx context.Context, req *auth.RefreshTokenRequest) (*auth.RefreshTokenResponse, error) {
-	ok, err := a.tokenCache.IsRevokedToken(ctx, req.RefreshToken, req.RefreshToken)
+	claims, err := a.extractClaims(req.RefreshToken)
+	if err != nil {
+		log.Println("Couldn't extract claims: ", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+	if claims.TokenType != models.TokenTypeRefresh || claims.FamilyID == "" {
+		return nil, status.Error(codes.Unauthenticated, "not a refresh token, log in again")
+	}
+
+	stale, err := a.staleGeneration(ctx, claims)
 	if err != nil {
 		log.Println("Checking token faild: ", err)
 		return nil, err
 	}
+	if stale {
+		return nil, status.Error(codes.Unauthenticated, "refresh token revoked")
+	}
 
-	if !ok {
-		return nil, fmt.Errorf("Refresh token revoked")
+	scopes, err := a.refreshScopes(ctx, claims, req.Scopes)
+	if err != nil {
+		return nil, err
 	}
 
-	claims, err := cache.ExtractClaims(req.RefreshToken)
+	tokenStatus, err := a.refreshTokenStatus(ctx, claims.ID)
 	if err != nil {
-		log.Println("Couldn't extract claims: ", err)
+		log.Println("Checking token faild: ", err)
 		return nil, err
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, models.Claims{
-		UserID: claims.UserID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 5)),
-		},
-	})
+	switch tokenStatus {
+	case cache.TokenStatusActive:
+	case models.RevokeReasonRotated:
+		a.refreshTokenReused(ctx, claims)
+		return nil, status.Error(codes.Unauthenticated, "refresh token reused, log in again")
+	default:
+		return nil, status.Error(codes.Unauthenticated, "refresh token revoked")
+	}
+
+	now := time.Now()
+	next := &models.Token{
+		JTI:        uuid.NewString(),
+		IPAddress:  clientIP(ctx),
+		Generation: claims.Generation,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+	}
 
-	accessTokenStr, err := accessToken.SignedString([]byte(a.cnf.JWT.SecretKey))
+	result, err := a.tokens.Rotate(ctx, claims.ID, next)
 	if err != nil {
-		log.Println("Failed to create access token: ", err)
+		log.Println("Failed to rotate refresh token: ", err)
 		return nil, err
 	}
 
-	return &auth.RefreshTokenResponse{AccessToken: accessTokenStr}, nil
+	switch result {
+	case postgres.RotationRevoked:
+		return nil, status.Error(codes.Unauthenticated, "refresh token revoked")
+	case postgres.RotationReused:
+		a.refreshTokenReused(ctx, claims)
+		return nil, status.Error(codes.Unauthenticated, "refresh token reused, log in again")
+	}
+
+	a.cacheTokenStatus(ctx, claims.ID, models.RevokeReasonRotated, claims.ExpiresAt.Time)
+	a.cacheTokenStatus(ctx, next.JTI, cache.TokenStatusActive, next.ExpiresAt)
+
+	roles, err := a.roles.ListForUser(ctx, next.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := a.newAccessToken(next, roles, formatScope(scopes), now)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := a.newRefreshToken(next)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Scope:        formatScope(scopes),
+	}, nil
+}
+
+// refreshTokenReused revokes the family of a replayed refresh token, so that
+// neither the thief nor the user can keep using it, and records the event.
+func (a *AuthService) refreshTokenReused(ctx context.Context, claims *models.Claims) {
+	log.Printf("Refresh token reuse detected for user %s, family %s", claims.UserID, claims.FamilyID)
+
+	if err := a.revokeFamily(ctx, claims.FamilyID, models.RevokeReasonReuseDetected); err != nil {
+		log.Println("Token Revocation failed: ", err)
+	}
+
+	err := a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    claims.UserID,
+		EventType: models.SecurityEventRefreshReuse,
+		IPAddress: clientIP(ctx),
+		Details:   fmt.Sprintf("family_id=%s jti=%s", claims.FamilyID, claims.ID),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
 }
 
 func (a *AuthService) Register(ctx context.Context, req *auth.RegisterRequest) (*auth.RegisterResponse, error) {
+	if err := a.checkPasswordPolicy("password", req.Password); err != nil {
+		return nil, err
+	}
+
 	newID := uuid.NewString()
 	user, err := a.user.CreateUser(ctx, &models.User{
 		UserId:         newID,
@@ -124,17 +312,37 @@ func (a *AuthService) Register(ctx context.Context, req *auth.RegisterRequest) (
 		return nil, err
 	}
 
+	if err := a.setUpNewUser(ctx, user.UserId); err != nil {
+		return nil, err
+	}
+
 	err = a.emailsender.SendVerificationEmail(req.Email, req.VerificationLink)
 	if err != nil {
 		return nil, err
 	}
 
 	return &auth.RegisterResponse{
-		UserId: newID,
+		UserId: user.UserId,
 		Email:  user.Email,
 	}, nil
 }
 
+// setUpNewUser gives a user who just signed up the customer role and the
+// default settings.
+func (a *AuthService) setUpNewUser(ctx context.Context, userID string) error {
+	if _, err := a.roles.Grant(ctx, userID, models.RoleCustomer, ""); err != nil {
+		log.Println("failed to grant default role: ", err)
+		return err
+	}
+
+	if err := a.settings.Create(ctx, defaultSettings(userID, a.cnf.Settings)); err != nil {
+		log.Println("failed to create default settings: ", err)
+		return err
+	}
+
+	return nil
+}
+
 func (a *AuthService) VerifyEmail(ctx context.Context, req *auth.VerifyEmailRequest) (*auth.VerifyEmailResponse, error) {
 	email, err := a.emailsender.cache.GetEmailByLink(req.Token)
 	if err != nil {
@@ -154,7 +362,12 @@ func (a *AuthService) VerifyEmail(ctx context.Context, req *auth.VerifyEmailRequ
 }
 
 func (a *AuthService) RevokeToken(ctx context.Context, req *auth.RevokeTokenRequest) (*auth.RevokeTokenResponse, error) {
-	if err := a.tokenCache.RevokeToken(ctx, &cache.RevokeTokens{AccessToken: req.Token}); err != nil {
+	claims, err := a.extractClaims(req.Token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid access token")
+	}
+
+	if err := a.tokenCache.RevokeToken(ctx, &cache.RevokeTokens{AccessToken: req.Token}, claims.ExpiresAt.Time); err != nil {
 		log.Println("Revocation access token failed: ", err)
 		return nil, err
 	}
@@ -162,39 +375,43 @@ func (a *AuthService) RevokeToken(ctx context.Context, req *auth.RevokeTokenRequ
 	return &auth.RevokeTokenResponse{Message: "Access token revoked"}, nil
 }
 
+// CreateToken starts a new login: it issues an access token and the first
+// refresh token of a new family.
 func (a *AuthService) CreateToken(ctx context.Context, req *auth.CreateTokenRequest) (*auth.CreateTokenResponse, error) {
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, models.Claims{
-		UserID: req.UserId,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 5)),
-		},
-	})
-
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, models.Claims{
-		UserID: req.UserId,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		},
-	})
+	userAgent := req.UserAgent
+	if userAgent == "" {
+		userAgent = userAgentFromContext(ctx)
+	}
 
-	accessTokenStr, err := accessToken.SignedString([]byte(a.cnf.JWT.SecretKey))
+	scopes, err := a.grantScopes(ctx, req.UserId, req.ClientId, req.Scopes)
 	if err != nil {
-		log.Println("Failed to create access token: ", err)
 		return nil, err
 	}
-	RefreshTokenStr, err := refreshToken.SignedString([]byte(a.cnf.JWT.SecretKey))
+
+	tokens, err := a.issueTokens(ctx, req.UserId, &models.Token{
+		DeviceName: req.DeviceName,
+		UserAgent:  userAgent,
+		IPAddress:  clientIP(ctx),
+		Scope:      formatScope(scopes),
+		ClientID:   req.ClientId,
+	})
 	if err != nil {
-		log.Println("Failed to create refresh token: ", err)
 		return nil, err
 	}
 
 	return &auth.CreateTokenResponse{
-		AccessToken:  accessTokenStr,
-		RefreshToken: RefreshTokenStr,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        formatScope(scopes),
 	}, nil
 }
 
-func (a *AuthService) GetToken(ctx context.Context, req *auth.GetTokenRequest) (*auth.GetTokenResponse, error) {
+// checkPasswordPolicy returns an InvalidArgument error listing every rule of
+// the password policy the password breaks.
+func (a *AuthService) checkPasswordPolicy(field, password string) error {
+	if violations := a.passwordPolicy.Check(password); len(violations) > 0 {
+		return passwordPolicyError(field, violations)
+	}
 
-	return nil, nil
+	return nil
 }
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"context"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (a *AuthService) ChangePassword(ctx context.Context, req *auth.ChangePasswordRequest) (*auth.ChangePasswordResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkPasswordPolicy("new_password", req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByID(ctx, claims.UserID)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return nil, err
+	}
+
+	// Guessing the current password counts towards the login lockout, or a
+	// stolen access token would allow guessing without limit.
+	attempt, err := a.reserveLoginAttempt(ctx, accountSubject(user), clientIP(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := a.comparePassword(user.HashedPassword, req.CurrentPassword); !ok {
+		if err := a.loginFailed(ctx, attempt); status.Code(err) != codes.Unauthenticated {
+			return nil, err
+		}
+		return nil, status.Error(codes.PermissionDenied, "current password is incorrect")
+	}
+	a.loginSucceeded(ctx, attempt)
+
+	hashedPassword, err := a.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	// The caller's session is carried over to the new tokens, so look it up
+	// before it is revoked with the others.
+	current, err := a.currentSession(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.user.UpdatePassword(ctx, user.UserId, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	// Cut off every token issued so far, then keep the caller signed in with
+	// a fresh pair in the same session, issued after the cut-off.
+	if err := a.revokeAllTokens(ctx, user.UserId, models.RevokeReasonPasswordChanged); err != nil {
+		log.Println("Failed to revoke user tokens: ", err)
+		return nil, err
+	}
+
+	err = a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    user.UserId,
+		EventType: models.SecurityEventPasswordChanged,
+		IPAddress: clientIP(ctx),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+
+	tokens, err := a.issueTokens(ctx, user.UserId, &models.Token{
+		FamilyID:   claims.FamilyID,
+		DeviceName: current.DeviceName,
+		UserAgent:  current.UserAgent,
+		IPAddress:  clientIP(ctx),
+		Scope:      claims.Scope,
+		ClientID:   claims.ClientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.ChangePasswordResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// currentSession returns the session the access token belongs to.
+func (a *AuthService) currentSession(ctx context.Context, claims *models.Claims) (*models.Session, error) {
+	sessions, err := a.tokens.ListSessions(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sessions {
+		if s.SessionID == claims.FamilyID {
+			return s, nil
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "session has ended")
+}
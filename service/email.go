@@ -5,6 +5,7 @@ import (
 	"auth_service/storage/cache"
 	"fmt"
 	"net/smtp"
+	"time"
 )
 
 type EmailSender struct {
@@ -33,23 +34,59 @@ func (e *EmailSender) SendVerificationEmail(toEmail, verificationLink string) er
 		return err
 	}
 
-	subject := "Subject: Please Verify Your Email Address\n"
+	subject := "Please Verify Your Email Address"
 	body := fmt.Sprintf("Hello,\n\nPlease verify your email address by clicking the following link:\n%s\n\nThank you!", verificationLink)
-	message := []byte(subject + "\n" + body)
+
+	if err := e.send(toEmail, subject, body); err != nil {
+		return fmt.Errorf("failed to send verification email: %v", err)
+	}
+
+	return nil
+}
+
+func (e *EmailSender) SendRecoveryCodeUsedEmail(toEmail string, remaining int) error {
+	subject := "A Recovery Code Was Used To Sign In"
+	body := fmt.Sprintf("Hello,\n\nOne of your two-factor recovery codes was just used to sign in to your account. You have %d recovery codes left.\n\nIf this wasn't you, change your password and regenerate your recovery codes right away.", remaining)
+
+	if err := e.send(toEmail, subject, body); err != nil {
+		return fmt.Errorf("failed to send recovery code email: %v", err)
+	}
+
+	return nil
+}
+
+func (e *EmailSender) SendPasswordResetEmail(toEmail, resetLink string, ttl time.Duration) error {
+	subject := "Reset Your Password"
+	body := fmt.Sprintf("Hello,\n\nWe received a request to reset your password. Use the following link within %s to choose a new one:\n%s\n\nIf you didn't ask for this, you can ignore this email.", ttl, resetLink)
+
+	if err := e.send(toEmail, subject, body); err != nil {
+		return fmt.Errorf("failed to send password reset email: %v", err)
+	}
+
+	return nil
+}
+
+func (e *EmailSender) SendMagicLinkEmail(toEmail, link string, ttl time.Duration) error {
+	subject := "Your Login Link"
+	body := fmt.Sprintf("Hello,\n\nUse the following link within %s to log in. It works once:\n%s\n\nIf you didn't ask for this, you can ignore this email.", ttl, link)
+
+	if err := e.send(toEmail, subject, body); err != nil {
+		return fmt.Errorf("failed to send magic link email: %v", err)
+	}
+
+	return nil
+}
+
+func (e *EmailSender) send(toEmail, subject, body string) error {
+	message := []byte("Subject: " + subject + "\n\n" + body)
 
 	auth := smtp.PlainAuth("", e.SenderEmail, e.Password, e.SMTPServer)
 
-	err = smtp.SendMail(
+	return smtp.SendMail(
 		e.SMTPServer+":"+e.SMTPPort,
 		auth,
 		e.SenderEmail,
 		[]string{toEmail},
 		message,
 	)
-
-	if err != nil {
-		return fmt.Errorf("failed to send verification email: %v", err)
-	}
-
-	return nil
 }
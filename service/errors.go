@@ -0,0 +1,113 @@
+package service
+
+import (
+	"auth_service/service/passwordpolicy"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is reported in errdetails.ErrorInfo so clients can tell our
+// errors apart from ones produced by proxies or other services.
+const errorDomain = "auth.food-delivery"
+
+const (
+	ReasonInvalidCredentials = "INVALID_CREDENTIALS"
+	ReasonAccountLocked      = "ACCOUNT_LOCKED"
+	ReasonPasswordPolicy     = "PASSWORD_POLICY"
+	ReasonInvalidCode        = "INVALID_CODE"
+	ReasonCodeRateLimited    = "CODE_RATE_LIMITED"
+)
+
+// withDetails attaches details to a status and falls back to the bare status
+// if they can't be encoded.
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) error {
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		log.Println("Failed to attach error details: ", err)
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+func invalidCredentialsError(attemptsLeft int) error {
+	return withDetails(
+		status.New(codes.Unauthenticated, "invalid email or password"),
+		&errdetails.ErrorInfo{
+			Reason:   ReasonInvalidCredentials,
+			Domain:   errorDomain,
+			Metadata: map[string]string{"attempts_left": strconv.Itoa(attemptsLeft)},
+		},
+	)
+}
+
+func accountLockedError(retryAfter time.Duration) error {
+	retryAfter = retryAfter.Round(time.Second)
+
+	return withDetails(
+		status.New(codes.ResourceExhausted, "too many failed login attempts, try again later"),
+		&errdetails.ErrorInfo{
+			Reason:   ReasonAccountLocked,
+			Domain:   errorDomain,
+			Metadata: map[string]string{"retry_after_seconds": strconv.Itoa(int(retryAfter.Seconds()))},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+}
+
+func invalidCodeError(attemptsLeft int) error {
+	return withDetails(
+		status.New(codes.Unauthenticated, "invalid or expired code"),
+		&errdetails.ErrorInfo{
+			Reason:   ReasonInvalidCode,
+			Domain:   errorDomain,
+			Metadata: map[string]string{"attempts_left": strconv.Itoa(attemptsLeft)},
+		},
+	)
+}
+
+func codeRateLimitedError(retryAfter time.Duration) error {
+	retryAfter = retryAfter.Round(time.Second)
+
+	return withDetails(
+		status.New(codes.ResourceExhausted, "a code or link was sent recently, try again later"),
+		&errdetails.ErrorInfo{
+			Reason:   ReasonCodeRateLimited,
+			Domain:   errorDomain,
+			Metadata: map[string]string{"retry_after_seconds": strconv.Itoa(int(retryAfter.Seconds()))},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+}
+
+// passwordPolicyError lists every failed rule twice: as field violations for
+// display, and in ErrorInfo metadata keyed by rule id for apps that map rules
+// to their own messages.
+func passwordPolicyError(field string, violations []passwordpolicy.Violation) error {
+	badRequest := &errdetails.BadRequest{}
+	info := &errdetails.ErrorInfo{
+		Reason:   ReasonPasswordPolicy,
+		Domain:   errorDomain,
+		Metadata: map[string]string{},
+	}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Description,
+		})
+		info.Metadata[v.Rule] = v.Value
+	}
+
+	return withDetails(
+		status.New(codes.InvalidArgument, "password does not meet the password policy"),
+		info,
+		badRequest,
+	)
+}
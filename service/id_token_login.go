@@ -0,0 +1,129 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/pkg/oidc"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// idTokenNonceTTL is how long a nonce from CreateIdTokenNonce can be used,
+// which covers signing in at the provider.
+const idTokenNonceTTL = 10 * time.Minute
+
+var errInvalidIdToken = status.Error(codes.Unauthenticated, "the id token is invalid or has expired")
+
+// CreateIdTokenNonce hands out a nonce for the client to pass to the
+// provider's sign-in SDK. LoginWithIdToken only accepts tokens carrying a
+// nonce from here, once, so that an ID token obtained elsewhere, with a nonce
+// of someone else's choosing, can't be used to log in.
+func (a *AuthService) CreateIdTokenNonce(ctx context.Context, req *auth.EmptyMessage) (*auth.IdTokenNonceResponse, error) {
+	nonce, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.tokenCache.SaveIdTokenNonce(ctx, nonce, idTokenNonceTTL); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &auth.IdTokenNonceResponse{Nonce: nonce, ExpiresIn: int64(idTokenNonceTTL.Seconds())}, nil
+}
+
+// LoginWithIdToken logs in with an ID token from an external provider. The
+// provider account is looked up by its subject; on first use it is linked to
+// the user with the same email if the provider and this service both
+// verified that email, otherwise a new user is created.
+func (a *AuthService) LoginWithIdToken(ctx context.Context, req *auth.LoginWithIdTokenRequest) (*auth.LoginResponse, error) {
+	provider, ok := a.oidcProviders[req.Provider]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown provider %q", req.Provider)
+	}
+	if req.IdToken == "" || req.Nonce == "" {
+		return nil, status.Error(codes.InvalidArgument, "id_token and nonce are required")
+	}
+
+	issued, err := a.tokenCache.ConsumeIdTokenNonce(ctx, req.Nonce)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if !issued {
+		return nil, errInvalidIdToken
+	}
+
+	token, err := provider.Verify(ctx, req.IdToken, req.Nonce)
+	if errors.Is(err, oidc.ErrInvalidIDToken) || errors.Is(err, oidc.ErrNonceMismatch) {
+		return nil, errInvalidIdToken
+	}
+	if err != nil {
+		log.Println("Failed to verify id token: ", err)
+		return nil, status.Error(codes.Unavailable, "couldn't verify the id token, try again later")
+	}
+
+	sum := sha256.Sum256([]byte(req.IdToken))
+	fresh, err := a.tokenCache.MarkIdTokenUsed(ctx, hex.EncodeToString(sum[:]), time.Until(token.ExpiresAt))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if !fresh {
+		return nil, errInvalidIdToken
+	}
+
+	userID, err := a.identities.GetUserID(ctx, req.Provider, token.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		userID, err = a.linkIdentity(ctx, req.Provider, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a.completeLogin(ctx, userID, req.DeviceName, req.ClientId, req.Scopes)
+}
+
+// linkIdentity links a provider account seen for the first time and returns
+// the user it belongs to.
+func (a *AuthService) linkIdentity(ctx context.Context, provider string, token *oidc.IDToken) (string, error) {
+	if token.EmailVerified {
+		user, err := a.user.GetByEmail(ctx, token.Email)
+		switch {
+		case err == nil:
+			// Someone may have registered the email without owning it;
+			// linking would hand them the provider login.
+			if !user.IsVerified {
+				return "", status.Error(codes.FailedPrecondition, "an account with this email exists but the email isn't verified, verify it or log in with the password first")
+			}
+
+			userID, err := a.identities.Link(ctx, provider, token.Subject, user.UserId, token.Email)
+			if err != nil {
+				log.Println("Failed to link identity: ", err)
+				return "", err
+			}
+			return userID, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			log.Println("Unexpected error has occured: ", err)
+			return "", err
+		}
+	}
+
+	userID, created, err := a.identities.CreateUser(ctx, provider, token.Subject, token.Email, token.EmailVerified)
+	if err == nil && created {
+		err = a.setUpNewUser(ctx, userID)
+	}
+	if err != nil {
+		log.Println("Failed to create user: ", err)
+		return "", err
+	}
+
+	return userID, nil
+}
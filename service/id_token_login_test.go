@@ -0,0 +1,207 @@
+package service
+
+import (
+	"auth_service/config"
+	"auth_service/genproto/auth"
+	"auth_service/pkg/jwtkeys"
+	"auth_service/pkg/oidc"
+	pkgPostgres "auth_service/pkg/postgres"
+	pkgRedis "auth_service/pkg/redis"
+	"auth_service/storage/cache"
+	"auth_service/storage/postgres"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newIdTokenTestService wires an AuthService to the Postgres and Redis named
+// by DB_* and REDIS_*, with migrations applied, and to a fake provider named
+// "fake". The test is skipped when they aren't set.
+func newIdTokenTestService(t *testing.T) (*AuthService, *oidc.FakeIssuer) {
+	t.Helper()
+	if os.Getenv("DB_HOST") == "" || os.Getenv("REDIS_HOST") == "" {
+		t.Skip("DB_HOST and REDIS_HOST aren't set")
+	}
+
+	cnf := &config.Config{
+		Database: config.DatabaseConfig{
+			Host:     os.Getenv("DB_HOST"),
+			Port:     os.Getenv("DB_PORT"),
+			User:     os.Getenv("DB_USER"),
+			Password: os.Getenv("DB_PASS"),
+			DBName:   os.Getenv("DB_NAME"),
+		},
+		Redis: config.RedisConfig{Host: os.Getenv("REDIS_HOST"), Port: os.Getenv("REDIS_PORT")},
+		Settings: config.UserSettingsConfig{
+			Languages:       []string{"en"},
+			DefaultLanguage: "en",
+			DefaultTimeZone: "UTC",
+		},
+	}
+
+	db, err := pkgPostgres.ConnectDB(cnf.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	rClient := pkgRedis.ConnectDB(&cnf.Redis)
+	t.Cleanup(func() { rClient.Close() })
+
+	issuer, err := oidc.NewFakeIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+
+	key, err := jwtkeys.GenerateKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &AuthService{
+		user:           postgres.NewUserManagementSQL(db, cache.NewAuthCache(rClient), nil),
+		cnf:            cnf,
+		tokenCache:     cache.NewTokenCache(rClient),
+		twoFactor:      postgres.NewTwoFactorSQL(db),
+		securityEvents: postgres.NewSecurityEventSQL(db),
+		tokens:         postgres.NewTokenSQL(db),
+		keys:           jwtkeys.NewKeyring(key),
+		roles:          postgres.NewRoleSQL(db),
+		scopes:         postgres.NewScopeSQL(db),
+		settings:       postgres.NewUserSettingsSQL(db, cache.NewSettingsCache(rClient)),
+		identities:     postgres.NewIdentitySQL(db),
+		oidcProviders:  map[string]*oidc.Provider{"fake": oidc.NewProvider(issuer.Config("app"))},
+		clients:        postgres.NewOAuthClientSQL(db),
+		consents:       postgres.NewConsentSQL(db),
+	}
+
+	return a, issuer
+}
+
+func TestLoginWithIdToken(t *testing.T) {
+	a, issuer := newIdTokenTestService(t)
+	other, err := oidc.NewFakeIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	ctx := context.Background()
+	subject := "subject-" + time.Now().Format("20060102150405.000000000")
+	newNonce := func() string {
+		resp, err := a.CreateIdTokenNonce(ctx, &auth.EmptyMessage{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Nonce
+	}
+	claims := func(iss, aud, nonce string, exp time.Time) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   iss,
+			"aud":   aud,
+			"sub":   subject,
+			"nonce": nonce,
+			"exp":   exp.Unix(),
+			"iat":   exp.Add(-10 * time.Minute).Unix(),
+		}
+	}
+	later := time.Now().Add(10 * time.Minute)
+
+	login := func(token, nonce string) (*auth.LoginResponse, error) {
+		return a.LoginWithIdToken(ctx, &auth.LoginWithIdTokenRequest{Provider: "fake", IdToken: token, Nonce: nonce})
+	}
+
+	// The first login creates the user, the second finds it by subject.
+	var userID string
+	for i := 0; i < 2; i++ {
+		nonce := newNonce()
+		token, err := issuer.IDToken("app", subject, "", nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := login(token, nonce)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		claims, err := a.extractClaims(resp.AccessToken)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if i == 1 && claims.UserID != userID {
+			t.Errorf("second login: got user %s, want %s", claims.UserID, userID)
+		}
+		userID = claims.UserID
+	}
+
+	tests := []struct {
+		name   string
+		signer *oidc.FakeIssuer
+		claims func(nonce string) jwt.MapClaims
+		nonce  func(issued string) string
+	}{
+		{
+			name:   "wrong issuer",
+			signer: issuer,
+			claims: func(nonce string) jwt.MapClaims { return claims(other.Issuer(), "app", nonce, later) },
+		},
+		{
+			name:   "wrong audience",
+			signer: issuer,
+			claims: func(nonce string) jwt.MapClaims { return claims(issuer.Issuer(), "other-app", nonce, later) },
+		},
+		{
+			name:   "expired",
+			signer: issuer,
+			claims: func(nonce string) jwt.MapClaims {
+				return claims(issuer.Issuer(), "app", nonce, time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name:   "wrong nonce",
+			signer: issuer,
+			claims: func(nonce string) jwt.MapClaims { return claims(issuer.Issuer(), "app", "other", later) },
+		},
+		{
+			name:   "nonce not issued",
+			signer: issuer,
+			claims: func(nonce string) jwt.MapClaims { return claims(issuer.Issuer(), "app", nonce, later) },
+			nonce:  func(string) string { return "not-issued" },
+		},
+		{
+			name:   "key not in jwks",
+			signer: other,
+			claims: func(nonce string) jwt.MapClaims { return claims(issuer.Issuer(), "app", nonce, later) },
+		},
+	}
+	for _, tt := range tests {
+		nonce := newNonce()
+		if tt.nonce != nil {
+			nonce = tt.nonce(nonce)
+		}
+		token, err := tt.signer.Sign(tt.claims(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := login(token, nonce); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: got %v, want Unauthenticated", tt.name, err)
+		}
+	}
+
+	// A token and its nonce only work once.
+	nonce := newNonce()
+	token, err := issuer.IDToken("app", subject, "", nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(token, nonce); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(token, nonce); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("replayed token: got %v, want Unauthenticated", err)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// userInactive is reported for tokens of users that no longer exist.
+const userInactive = "user_inactive"
+
+func (a *AuthService) GetToken(ctx context.Context, req *auth.GetTokenRequest) (*auth.GetTokenResponse, error) {
+	claims, err := a.extractClaims(req.Token)
+	if err != nil {
+		return &auth.GetTokenResponse{Active: false}, nil
+	}
+	// Login links and the like are signed with the same keys but grant
+	// nothing by themselves.
+	if claims.TokenType != models.TokenTypeAccess && claims.TokenType != models.TokenTypeRefresh {
+		return &auth.GetTokenResponse{Active: false}, nil
+	}
+
+	resp := &auth.GetTokenResponse{
+		Sub:       claims.UserID,
+		TokenType: claims.TokenType,
+		Jti:       claims.ID,
+		SessionId: claims.FamilyID,
+		Roles:     claims.Roles,
+		Scope:     claims.Scope,
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+
+	if claims.TokenType == models.TokenTypeRefresh {
+		resp.RevocationReason, err = a.refreshTokenRevocation(ctx, claims)
+	} else {
+		resp.RevocationReason, err = a.accessTokenRevocation(ctx, req.Token, claims)
+	}
+	if err != nil {
+		log.Println("Checking token failed: ", err)
+		return nil, err
+	}
+	if resp.RevocationReason != "" {
+		return resp, nil
+	}
+
+	user, err := a.user.GetByID(ctx, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		resp.RevocationReason = userInactive
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Active = true
+	resp.Email = user.Email
+
+	return resp, nil
+}
+
+// accessTokenRevocation returns why the access token was revoked, or an
+// empty string if it is still good.
+func (a *AuthService) accessTokenRevocation(ctx context.Context, token string, claims *models.Claims) (string, error) {
+	revoked, err := a.tokenCache.IsRevokedToken(ctx, "", token)
+	if err != nil {
+		return "", err
+	}
+	if revoked {
+		return models.RevokeReasonRevoked, nil
+	}
+
+	if claims.FamilyID != "" {
+		reason, err := a.tokenCache.RevokedSessionReason(ctx, claims.FamilyID)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+
+	return a.generationRevocation(ctx, claims)
+}
+
+// refreshTokenRevocation is accessTokenRevocation for refresh tokens, which
+// are tracked one by one in Postgres.
+func (a *AuthService) refreshTokenRevocation(ctx context.Context, claims *models.Claims) (string, error) {
+	tokenStatus, err := a.refreshTokenStatus(ctx, claims.ID)
+	if err != nil {
+		return "", err
+	}
+	if tokenStatus != cache.TokenStatusActive {
+		return tokenStatus, nil
+	}
+
+	return a.generationRevocation(ctx, claims)
+}
+
+func (a *AuthService) generationRevocation(ctx context.Context, claims *models.Claims) (string, error) {
+	stale, err := a.staleGeneration(ctx, claims)
+	if err != nil || !stale {
+		return "", err
+	}
+
+	return models.RevokeReasonSuperseded, nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"context"
+)
+
+func (a *AuthService) GetJwks(ctx context.Context, req *auth.EmptyMessage) (*auth.GetJwksResponse, error) {
+	resp := &auth.GetJwksResponse{}
+	for _, key := range a.keys.JWKS().Keys {
+		resp.Keys = append(resp.Keys, &auth.Jwk{
+			Kty: key.Kty,
+			Use: key.Use,
+			Alg: key.Alg,
+			Kid: key.Kid,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+		})
+	}
+
+	return resp, nil
+}
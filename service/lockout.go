@@ -0,0 +1,121 @@
+package service
+
+import (
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"log"
+	"time"
+)
+
+// loginAttempt is a login attempt counted for an account subject and the
+// client IP before the credentials are checked.
+type loginAttempt struct {
+	subject string
+	ip      string
+	// left and ipLeft are the attempts left after this one.
+	left   int
+	ipLeft int
+}
+
+// reserveLoginAttempt counts an attempt for the account subject and the
+// client IP before the credentials are checked, so that concurrent guesses
+// can't get past the limits. It fails with an ACCOUNT_LOCKED error while
+// either is locked. The IP is counted first, so that a locked IP can't use up
+// the attempts of accounts.
+func (a *AuthService) reserveLoginAttempt(ctx context.Context, subject, ip string) (*loginAttempt, error) {
+	attempt := &loginAttempt{subject: subject, ip: ip}
+
+	if ip != "" {
+		left, lockedFor, err := a.loginAttempts.RegisterAttempt(ctx, cache.IPSubject(ip), a.cnf.Lockout.MaxAttemptsPerIP)
+		if err != nil {
+			log.Println("Failed to register login attempt: ", err)
+			return nil, err
+		}
+		if lockedFor > 0 {
+			return nil, accountLockedError(lockedFor)
+		}
+		attempt.ipLeft = left
+	}
+
+	left, lockedFor, err := a.loginAttempts.RegisterAttempt(ctx, subject, a.cnf.Lockout.MaxAttempts)
+	if err != nil {
+		log.Println("Failed to register login attempt: ", err)
+		return nil, err
+	}
+	if lockedFor > 0 {
+		return nil, accountLockedError(lockedFor)
+	}
+	attempt.left = left
+
+	return attempt, nil
+}
+
+// loginFailed locks the account subject or the client IP if the attempt was
+// the last one allowed, and returns the error to report to the client. Wrong
+// second factors and current passwords count too, not only wrong passwords
+// at login.
+func (a *AuthService) loginFailed(ctx context.Context, attempt *loginAttempt) error {
+	var lockedFor time.Duration
+	if attempt.left == 0 {
+		var err error
+		if lockedFor, err = a.loginAttempts.Lock(ctx, attempt.subject); err != nil {
+			log.Println("Failed to lock login: ", err)
+			return err
+		}
+	}
+
+	if attempt.ip != "" && attempt.ipLeft == 0 {
+		ipLockedFor, err := a.loginAttempts.Lock(ctx, cache.IPSubject(attempt.ip))
+		if err != nil {
+			log.Println("Failed to lock login: ", err)
+			return err
+		}
+		if ipLockedFor > lockedFor {
+			lockedFor = ipLockedFor
+		}
+	}
+
+	if lockedFor > 0 {
+		log.Printf("Login locked for %s (ip %s) for %s", attempt.subject, attempt.ip, lockedFor)
+		return accountLockedError(lockedFor)
+	}
+
+	return invalidCredentialsError(attempt.left)
+}
+
+// loginSucceeded clears the attempts of the account subject and of the
+// client IP after a complete login.
+func (a *AuthService) loginSucceeded(ctx context.Context, attempt *loginAttempt) {
+	for _, subject := range attempt.subjects() {
+		if err := a.loginAttempts.Reset(ctx, subject); err != nil {
+			log.Println("Failed to reset login attempts: ", err)
+		}
+	}
+}
+
+// loginPending takes back an attempt with the right password when the login
+// still needs a second factor. The attempts made so far are kept, so that
+// logging in again doesn't give a fresh counter for guessing codes.
+func (a *AuthService) loginPending(ctx context.Context, attempt *loginAttempt) {
+	for _, subject := range attempt.subjects() {
+		if err := a.loginAttempts.ReleaseAttempt(ctx, subject); err != nil {
+			log.Println("Failed to release login attempt: ", err)
+		}
+	}
+}
+
+func (l *loginAttempt) subjects() []string {
+	if l.ip == "" {
+		return []string{l.subject}
+	}
+	return []string{l.subject, cache.IPSubject(l.ip)}
+}
+
+// accountSubject is the subject failed attempts of a known user count for.
+func accountSubject(user *models.User) string {
+	if user.Email == "" {
+		return cache.UserSubject(user.UserId)
+	}
+	return cache.EmailSubject(user.Email)
+}
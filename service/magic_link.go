@@ -0,0 +1,142 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInvalidMagicLink = status.Error(codes.InvalidArgument, "the login link is invalid or has expired")
+
+// RequestMagicLink emails a login link. The token in it is signed, and its
+// ID is kept in Redis until the link is used, so each link works once. The
+// link is made and sent in the background, so that neither the response nor
+// its timing tell registered emails apart.
+func (a *AuthService) RequestMagicLink(ctx context.Context, req *auth.RequestMagicLinkRequest) (*auth.EmptyMessage, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	subjects := []string{cache.EmailSubject(req.Email)}
+	if ip := clientIP(ctx); ip != "" {
+		subjects = append(subjects, cache.IPSubject(ip))
+	}
+	for _, subject := range subjects {
+		ok, err := a.emailsender.cache.ReserveMagicLink(ctx, subject, a.cnf.MagicLink.ResendInterval)
+		if err != nil {
+			log.Println("Failed to check magic link cooldown: ", err)
+			return nil, err
+		}
+		if !ok {
+			return nil, codeRateLimitedError(a.cnf.MagicLink.ResendInterval)
+		}
+	}
+
+	go a.sendMagicLink(context.WithoutCancel(ctx), req.Email)
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) sendMagicLink(ctx context.Context, email string) {
+	user, err := a.user.GetByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("Magic link requested for unknown email: ", email)
+		return
+	}
+	if err != nil {
+		log.Println("Unexpected error has occured: ", err)
+		return
+	}
+
+	generation, err := a.tokenGeneration(ctx, user.UserId)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	ttl := a.cnf.MagicLink.TTL
+	jti := uuid.NewString()
+	token, err := a.signToken(models.Claims{
+		UserID:     user.UserId,
+		TokenType:  models.TokenTypeMagicLink,
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+	if err != nil {
+		log.Println("Failed to create magic link token: ", err)
+		return
+	}
+
+	if err := a.emailsender.cache.SaveMagicLink(ctx, jti, user.UserId, ttl); err != nil {
+		log.Println("Failed to save magic link: ", err)
+		return
+	}
+
+	link, err := tokenLink(a.cnf.MagicLink.LinkBaseURL, token)
+	if err != nil {
+		log.Println("Invalid magic link url: ", err)
+		return
+	}
+
+	if err := a.emailsender.SendMagicLinkEmail(user.Email, link, ttl); err != nil {
+		log.Println(err)
+	}
+}
+
+// ConsumeMagicLink logs in with a link from RequestMagicLink. Using the link
+// proves the email, so the user is marked verified. Users with two-factor
+// authentication still get a challenge.
+func (a *AuthService) ConsumeMagicLink(ctx context.Context, req *auth.ConsumeMagicLinkRequest) (*auth.LoginResponse, error) {
+	claims, err := a.extractClaims(req.Token)
+	if err != nil || claims.TokenType != models.TokenTypeMagicLink {
+		return nil, errInvalidMagicLink
+	}
+
+	userID, err := a.emailsender.cache.ConsumeMagicLink(ctx, claims.ID)
+	if err != nil {
+		log.Println("Failed to consume magic link: ", err)
+		return nil, err
+	}
+	if userID == "" || userID != claims.UserID {
+		return nil, errInvalidMagicLink
+	}
+
+	// Links sent before a password change or a log out everywhere are void.
+	stale, err := a.staleGeneration(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		return nil, errInvalidMagicLink
+	}
+
+	user, err := a.user.GetByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsVerified {
+		if err := a.user.VerifiyUser(ctx, user.Email); err != nil {
+			log.Println("Failed to verify user: ", err)
+		}
+	}
+
+	return a.completeLogin(ctx, user.UserId, req.DeviceName, req.ClientId, req.Scopes)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"auth_service/models"
+	"auth_service/pkg/authclient"
+	"context"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// authenticate returns the claims of the caller's access token. They are
+// usually already verified by the server's auth interceptor.
+func (a *AuthService) authenticate(ctx context.Context) (*models.Claims, error) {
+	if claims, ok := authclient.ClaimsFromContext(ctx); ok {
+		return claims, nil
+	}
+
+	token, err := authclient.BearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Authenticate(ctx, token)
+}
+
+// Authenticate verifies an access token, including whether it was revoked.
+// It implements authclient.Authenticator for the server's auth interceptor.
+func (a *AuthService) Authenticate(ctx context.Context, token string) (*models.Claims, error) {
+	claims, err := a.extractClaims(token)
+	if err != nil || claims.TokenType != models.TokenTypeAccess {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	reason, err := a.accessTokenRevocation(ctx, token, claims)
+	if err != nil {
+		log.Println("Checking token failed: ", err)
+		return nil, err
+	}
+	if reason != "" {
+		return nil, status.Error(codes.Unauthenticated, "access token revoked")
+	}
+
+	return claims, nil
+}
+
+// authenticateAdmin is authenticate for RPCs only admins may call.
+func (a *AuthService) authenticateAdmin(ctx context.Context) (*models.Claims, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.HasRole(models.RoleAdmin) {
+		return nil, status.Error(codes.PermissionDenied, "admin access required")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const totpPeriod = 30
+
+func (a *AuthService) EnableTwoFactor(ctx context.Context, req *auth.EmptyMessage) (*auth.EnableTwoFactorResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByID(ctx, claims.UserID)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return nil, err
+	}
+
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, user.UserId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return nil, status.Error(codes.AlreadyExists, "two-factor authentication is already enabled")
+	}
+
+	accountName := user.Email
+	if accountName == "" {
+		accountName = user.PhoneNumber
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      a.cnf.Mfa.Issuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		log.Println("Failed to generate totp secret: ", err)
+		return nil, err
+	}
+
+	if err := a.twoFactor.SaveSecret(ctx, user.UserId, key.Secret()); err != nil {
+		return nil, err
+	}
+
+	return &auth.EnableTwoFactorResponse{
+		Secret:     key.Secret(),
+		OtpauthUri: key.URL(),
+	}, nil
+}
+
+func (a *AuthService) ConfirmTwoFactor(ctx context.Context, req *auth.ConfirmTwoFactorRequest) (*auth.ConfirmTwoFactorResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor enrollment has not been started")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, status.Error(codes.AlreadyExists, "two-factor authentication is already enabled")
+	}
+
+	ok, err := a.verifyTOTP(ctx, twoFactor, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid verification code")
+	}
+
+	// The codes are stored first, so that two-factor authentication is never
+	// enabled without a way to recover from a lost device. If enabling fails,
+	// confirming again replaces them.
+	recoveryCodes, err := a.newRecoveryCodes(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.twoFactor.Enable(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	return &auth.ConfirmTwoFactorResponse{
+		Message:       "Two-factor authentication enabled",
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+func (a *AuthService) DisableTwoFactor(ctx context.Context, req *auth.DisableTwoFactorRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if twoFactor.Enabled {
+		ok, err := a.verifyTOTP(ctx, twoFactor, req.Code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "invalid verification code")
+		}
+	}
+
+	if err := a.twoFactor.Delete(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+	if err := a.recoveryCodes.DeleteByUserID(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	// Other devices have to sign in again, now without a second factor.
+	if err := a.revokeOtherSessions(ctx, claims, models.RevokeReasonTwoFactorDisabled); err != nil {
+		log.Println("Token Revocation failed: ", err)
+		return nil, err
+	}
+
+	err = a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    claims.UserID,
+		EventType: models.SecurityEventTwoFactorDisabled,
+		IPAddress: clientIP(ctx),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) VerifyMfa(ctx context.Context, req *auth.VerifyMfaRequest) (*auth.LoginResponse, error) {
+	challenge, err := a.mfaCache.GetChallenge(ctx, req.MfaToken)
+	if err != nil {
+		log.Println("Failed to get mfa challenge: ", err)
+		return nil, err
+	}
+	if challenge == nil {
+		return nil, status.Error(codes.Unauthenticated, "mfa challenge expired, log in again")
+	}
+	userID := challenge.UserID
+
+	user, err := a.user.GetByID(ctx, userID)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return nil, err
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords.
+	attempt, err := a.reserveLoginAttempt(ctx, accountSubject(user), clientIP(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// The attempt is counted before the code is checked, so that parallel
+	// guesses can't get past MaxAttempts.
+	attempts, err := a.mfaCache.RegisterAttempt(ctx, req.MfaToken, a.cnf.Mfa.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > int64(a.cnf.Mfa.MaxAttempts) {
+		return nil, a.tooManyMfaAttempts(ctx, req.MfaToken)
+	}
+
+	var ok bool
+	if req.RecoveryCode != "" {
+		ok, err = a.useRecoveryCode(ctx, userID, req.RecoveryCode)
+	} else {
+		var twoFactor *models.TwoFactor
+		twoFactor, err = a.twoFactor.GetByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		ok, err = a.verifyTOTP(ctx, twoFactor, req.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := a.loginFailed(ctx, attempt); status.Code(err) != codes.Unauthenticated {
+			if err := a.mfaCache.DeleteChallenge(ctx, req.MfaToken); err != nil {
+				log.Println("Failed to delete mfa challenge: ", err)
+			}
+			return nil, err
+		}
+
+		if attempts >= int64(a.cnf.Mfa.MaxAttempts) {
+			return nil, a.tooManyMfaAttempts(ctx, req.MfaToken)
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid verification code")
+	}
+
+	if err := a.mfaCache.DeleteChallenge(ctx, req.MfaToken); err != nil {
+		return nil, err
+	}
+	a.loginSucceeded(ctx, attempt)
+
+	tokens, err := a.CreateToken(ctx, &auth.CreateTokenRequest{
+		UserId:     userID,
+		DeviceName: req.DeviceName,
+		Scopes:     challenge.Scopes,
+		ClientId:   challenge.ClientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.LoginResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken, Scope: tokens.Scope}, nil
+}
+
+// tooManyMfaAttempts ends the challenge once its attempts are used up.
+func (a *AuthService) tooManyMfaAttempts(ctx context.Context, token string) error {
+	if err := a.mfaCache.DeleteChallenge(ctx, token); err != nil {
+		return err
+	}
+
+	return status.Error(codes.Unauthenticated, "too many invalid codes, log in again")
+}
+
+// startMfaChallenge issues the challenge Login returns instead of tokens to
+// users with two-factor authentication enabled.
+func (a *AuthService) startMfaChallenge(ctx context.Context, challenge *cache.MfaChallenge) (*auth.LoginResponse, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.mfaCache.SaveChallenge(ctx, token, challenge, a.cnf.Mfa.ChallengeTTL); err != nil {
+		log.Println("Failed to save mfa challenge: ", err)
+		return nil, err
+	}
+
+	return &auth.LoginResponse{MfaRequired: true, MfaToken: token}, nil
+}
+
+// verifyTOTP checks the code against the current time step and one step on
+// either side to allow for clock drift. A step is accepted only once.
+func (a *AuthService) verifyTOTP(ctx context.Context, twoFactor *models.TwoFactor, code string) (bool, error) {
+	step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return a.twoFactor.UseStep(ctx, twoFactor.UserID, step)
+}
+
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			log.Println("Failed to generate totp code: ", err)
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
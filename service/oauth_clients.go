@@ -0,0 +1,140 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var clientIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,63}$`)
+
+// RegisterOAuthClient registers a client of the OpenID Connect provider.
+func (a *AuthService) RegisterOAuthClient(ctx context.Context, req *auth.RegisterOAuthClientRequest) (*auth.RegisterOAuthClientResponse, error) {
+	if _, err := a.authenticateAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := validateOAuthClient(req); err != nil {
+		return nil, err
+	}
+
+	client := &models.OAuthClient{
+		ClientID:      req.ClientId,
+		Name:          req.Name,
+		AllowedScopes: req.AllowedScopes,
+		RedirectURIs:  req.RedirectUris,
+		FirstParty:    req.FirstParty,
+	}
+
+	var secret string
+	if req.Confidential {
+		var err error
+		if secret, err = randomToken(32); err != nil {
+			return nil, err
+		}
+		client.SecretHash = hashClientSecret(secret)
+	}
+
+	created, err := a.clients.Create(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, status.Errorf(codes.AlreadyExists, "client %q already exists", req.ClientId)
+	}
+
+	return &auth.RegisterOAuthClientResponse{ClientId: client.ClientID, ClientSecret: secret}, nil
+}
+
+// RevokeConsent withdraws the caller's consent to the client. Its tokens for
+// the caller are revoked, access tokens included, so it loses access at once.
+func (a *AuthService) RevokeConsent(ctx context.Context, req *auth.RevokeConsentRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := a.consents.Revoke(ctx, claims.UserID, req.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, status.Error(codes.NotFound, "no consent to this client")
+	}
+
+	families, err := a.tokens.RevokeForClient(ctx, claims.UserID, req.ClientId, models.RevokeReasonConsentRevoked)
+	if err != nil {
+		return nil, err
+	}
+	for familyID, jtis := range families {
+		if err := a.familyRevoked(ctx, familyID, jtis, models.RevokeReasonConsentRevoked); err != nil {
+			log.Println("Redis Error: ", err)
+		}
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func validateOAuthClient(req *auth.RegisterOAuthClientRequest) error {
+	badRequest := &errdetails.BadRequest{}
+	violation := func(field, description string) {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+
+	if !clientIDPattern.MatchString(req.ClientId) {
+		violation("client_id", "must be 3 to 64 lower case letters, digits, dots, dashes or underscores")
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		violation("name", "is required")
+	}
+	if len(req.AllowedScopes) == 0 {
+		violation("allowed_scopes", "at least one scope is required")
+	}
+	for _, uri := range req.RedirectUris {
+		if !validRedirectURI(uri) {
+			violation("redirect_uris", uri+" must be an https URL, an http URL on a loopback address or a private-use scheme like com.example.app:/callback, without fragment")
+		}
+	}
+
+	if len(badRequest.FieldViolations) == 0 {
+		return nil
+	}
+
+	return withDetails(status.New(codes.InvalidArgument, "invalid client"), badRequest)
+}
+
+// validRedirectURI accepts the redirect URIs of RFC 8252 besides https:
+// loopback http for native apps, and private-use schemes named after a
+// domain.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || strings.Contains(raw, "#") {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
@@ -0,0 +1,610 @@
+package service
+
+import (
+	"auth_service/config"
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"auth_service/storage/postgres"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const idTokenTTL = time.Hour
+
+// Errors of OpenIDProvider.Login for users with two-factor authentication,
+// when no code or a wrong one was given.
+var (
+	ErrMfaRequired             = errors.New("verification code required")
+	ErrInvalidVerificationCode = status.Error(codes.Unauthenticated, "invalid verification code")
+)
+
+// PKCE code challenges and verifiers are 43 to 128 characters (RFC 7636).
+var (
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43,128}$`)
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+)
+
+// OAuthError is an error response of RFC 6749, returned to the client as is.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, format string, args ...interface{}) *OAuthError {
+	return &OAuthError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// OpenIDProvider implements OpenID Connect on top of the logins of the
+// AuthService: the authorization code flow with PKCE, the token endpoint
+// and userinfo. The api package serves it over HTTP.
+type OpenIDProvider struct {
+	auth     *AuthService
+	profiles *postgres.UserProfileImpl
+	codes    *cache.AuthCodeCache
+	cnf      config.OpenIDConfig
+}
+
+func NewOpenIDProvider(auth *AuthService, profiles *postgres.UserProfileImpl, codes *cache.AuthCodeCache, cnf config.OpenIDConfig) *OpenIDProvider {
+	return &OpenIDProvider{
+		auth:     auth,
+		profiles: profiles,
+		codes:    codes,
+		cnf:      cnf,
+	}
+}
+
+// Issuer returns the issuer identifier, the base URL of the endpoints.
+func (p *OpenIDProvider) Issuer() string {
+	return p.cnf.Issuer
+}
+
+// SessionTTL is how long a browser session lasts.
+func (p *OpenIDProvider) SessionTTL() time.Duration {
+	return p.cnf.SessionTTL
+}
+
+// Discovery is the provider metadata of OpenID Connect Discovery 1.0.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+func (p *OpenIDProvider) Discovery() *Discovery {
+	return &Discovery{
+		Issuer:                            p.cnf.Issuer,
+		AuthorizationEndpoint:             p.cnf.Issuer + "/authorize",
+		TokenEndpoint:                     p.cnf.Issuer + "/token",
+		UserinfoEndpoint:                  p.cnf.Issuer + "/userinfo",
+		JwksURI:                           p.cnf.Issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   openIDScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  p.auth.keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "phone_number", "phone_number_verified",
+			"name", "given_name", "family_name", "picture", "locale", "zoneinfo",
+		},
+		AuthorizationResponseIssParameter: true,
+	}
+}
+
+// AuthorizationRequest holds the parameters of a request to /authorize.
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// Client returns the client of an authorization request. Errors mean the
+// redirect URI can't be trusted, so they must be shown to the user instead
+// of being sent to it.
+func (p *OpenIDProvider) Client(ctx context.Context, clientID, redirectURI string) (*models.OAuthClient, error) {
+	client, err := p.auth.clients.GetByID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, oauthError("invalid_request", "unknown client %q", clientID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		return nil, oauthError("invalid_request", "redirect_uri isn't registered for the client")
+	}
+
+	return client, nil
+}
+
+// CheckRequest validates the parameters of an authorization request other
+// than the client and redirect URI.
+func (p *OpenIDProvider) CheckRequest(client *models.OAuthClient, req *AuthorizationRequest) error {
+	if req.ResponseType != "code" {
+		return oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+	if !slices.Contains(parseScope(req.Scope), "openid") {
+		return oauthError("invalid_scope", "the openid scope is required")
+	}
+	if !slices.Contains(client.AllowedScopes, "openid") {
+		return oauthError("unauthorized_client", "the client isn't registered for OpenID Connect")
+	}
+	// PKCE is required from every client, confidential ones included.
+	if req.CodeChallengeMethod != "S256" || !codeChallengePattern.MatchString(req.CodeChallenge) {
+		return oauthError("invalid_request", "a code_challenge with code_challenge_method S256 is required")
+	}
+
+	return nil
+}
+
+// BrowserSession is a browser logged in to the provider.
+type BrowserSession struct {
+	// Token is kept in a cookie by the browser.
+	Token    string
+	UserID   string
+	AuthTime time.Time
+}
+
+// Session returns the session of the token from the browser's cookie, or
+// nil if it isn't valid any more.
+func (p *OpenIDProvider) Session(ctx context.Context, token string) *BrowserSession {
+	if token == "" {
+		return nil
+	}
+
+	claims, err := p.auth.extractClaims(token)
+	if err != nil || claims.TokenType != models.TokenTypeBrowserSession || claims.IssuedAt == nil {
+		return nil
+	}
+
+	// Logging out everywhere or changing the password ends it too.
+	stale, err := p.auth.staleGeneration(ctx, claims)
+	if err != nil || stale {
+		return nil
+	}
+
+	return &BrowserSession{Token: token, UserID: claims.UserID, AuthTime: claims.IssuedAt.Time}
+}
+
+// Login checks the credentials entered on the login page and starts a
+// browser session. It returns ErrMfaRequired if the user has two-factor
+// authentication and code is empty; code may also be a recovery code.
+// Failures count towards the same lockout as Login over gRPC.
+func (p *OpenIDProvider) Login(ctx context.Context, email, password, code string) (*BrowserSession, error) {
+	a := p.auth
+	attempt, err := a.reserveLoginAttempt(ctx, cache.EmailSubject(email), clientIP(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("Unexpected error has occured: ", err)
+		return nil, err
+	}
+	if user == nil {
+		a.hasher.Dummy(password)
+		return nil, a.loginFailed(ctx, attempt)
+	}
+
+	ok, needsRehash := a.comparePassword(user.HashedPassword, password)
+	if !ok {
+		return nil, a.loginFailed(ctx, attempt)
+	}
+	if needsRehash {
+		a.rehashPassword(ctx, user.UserId, password)
+	}
+
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, user.UserId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("Failed to get two factor auth: ", err)
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		if code == "" {
+			a.loginPending(ctx, attempt)
+			return nil, ErrMfaRequired
+		}
+
+		ok, err := a.verifyTOTP(ctx, twoFactor, code)
+		if err == nil && !ok {
+			ok, err = a.useRecoveryCode(ctx, user.UserId, code)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if err := a.loginFailed(ctx, attempt); status.Code(err) != codes.Unauthenticated {
+				return nil, err
+			}
+			return nil, ErrInvalidVerificationCode
+		}
+	}
+
+	a.loginSucceeded(ctx, attempt)
+
+	return p.newSession(ctx, user.UserId)
+}
+
+func (p *OpenIDProvider) newSession(ctx context.Context, userID string) (*BrowserSession, error) {
+	generation, err := p.auth.tokenGeneration(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token, err := p.auth.signToken(models.Claims{
+		UserID:     userID,
+		TokenType:  models.TokenTypeBrowserSession,
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.cnf.SessionTTL)),
+		},
+	})
+	if err != nil {
+		log.Println("Failed to create browser session: ", err)
+		return nil, err
+	}
+
+	return &BrowserSession{Token: token, UserID: userID, AuthTime: now}, nil
+}
+
+// GrantScopes works out the scopes the client gets for the user, the same
+// way as for logins over gRPC.
+func (p *OpenIDProvider) GrantScopes(ctx context.Context, client *models.OAuthClient, userID string, req *AuthorizationRequest) ([]string, error) {
+	scopes, err := p.auth.grantScopes(ctx, userID, client.ClientID, parseScope(req.Scope))
+	if status.Code(err) == codes.InvalidArgument {
+		return nil, oauthError("invalid_scope", "%s", status.Convert(err).Message())
+	}
+
+	return scopes, err
+}
+
+// NeedsConsent reports whether the user has yet to allow the client the
+// scopes. First party clients don't need consent.
+func (p *OpenIDProvider) NeedsConsent(ctx context.Context, client *models.OAuthClient, userID string, scopes []string) (bool, error) {
+	if client.FirstParty {
+		return false, nil
+	}
+
+	consented, err := p.auth.consents.GetScopes(ctx, userID, client.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consented, scope) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Consent records that the user allowed the client the scopes.
+func (p *OpenIDProvider) Consent(ctx context.Context, client *models.OAuthClient, userID string, scopes []string) error {
+	return p.auth.consents.Grant(ctx, userID, client.ClientID, scopes)
+}
+
+// IssueCode issues the authorization code the client exchanges for tokens.
+func (p *OpenIDProvider) IssueCode(ctx context.Context, req *AuthorizationRequest, session *BrowserSession, scopes []string) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.codes.SaveCode(ctx, code, &cache.AuthCode{
+		UserID:        session.UserID,
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      session.AuthTime.Unix(),
+	}, p.cnf.CodeTTL)
+	if err != nil {
+		log.Println("Failed to save auth code: ", err)
+		return "", err
+	}
+
+	return code, nil
+}
+
+// TokenRequest holds the parameters of a request to /token.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+// TokenResponse is the successful response of /token.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Token exchanges an authorization code or a refresh token. The tokens are
+// the same as those of logins over gRPC, plus an ID token for codes.
+func (p *OpenIDProvider) Token(ctx context.Context, req *TokenRequest) (*TokenResponse, error) {
+	client, err := p.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return p.exchangeCode(ctx, client, req)
+	case "refresh_token":
+		return p.refresh(ctx, client, req)
+	default:
+		return nil, oauthError("unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+// authenticateClient checks the secret of confidential clients. The secrets
+// are random, so a plain SHA-256 is enough to store them.
+func (p *OpenIDProvider) authenticateClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, oauthError("invalid_client", "client authentication is required")
+	}
+
+	client, err := p.auth.clients.GetByID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential() {
+		if secret != "" {
+			return nil, oauthError("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "invalid client credentials")
+	}
+
+	return client, nil
+}
+
+func (p *OpenIDProvider) exchangeCode(ctx context.Context, client *models.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	if req.Code == "" || !codeVerifierPattern.MatchString(req.CodeVerifier) {
+		return nil, oauthError("invalid_request", "code and a valid code_verifier are required")
+	}
+
+	code, err := p.codes.ConsumeCode(ctx, req.Code)
+	if err != nil {
+		log.Println("Failed to consume auth code: ", err)
+		return nil, err
+	}
+	if code == nil || code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "the code is invalid or has expired")
+	}
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(code.CodeChallenge)) != 1 {
+		return nil, oauthError("invalid_grant", "code_verifier doesn't match the code_challenge")
+	}
+
+	user, err := p.auth.user.GetByID(ctx, code.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.auth.CreateToken(ctx, &auth.CreateTokenRequest{
+		UserId:     user.UserId,
+		DeviceName: client.Name,
+		Scopes:     code.Scopes,
+		ClientId:   client.ClientID,
+	})
+	if status.Code(err) == codes.InvalidArgument {
+		return nil, oauthError("invalid_grant", "%s", status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := p.idToken(ctx, user, client.ClientID, code, parseScope(tokens.Scope))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      idToken,
+		Scope:        tokens.Scope,
+	}, nil
+}
+
+func (p *OpenIDProvider) refresh(ctx context.Context, client *models.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	claims, err := p.auth.extractClaims(req.RefreshToken)
+	if err != nil || claims.ClientID != client.ClientID {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+
+	tokens, err := p.auth.RefreshToken(ctx, &auth.RefreshTokenRequest{
+		RefreshToken: req.RefreshToken,
+		Scopes:       parseScope(req.Scope),
+	})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Unauthenticated:
+		return nil, oauthError("invalid_grant", "%s", status.Convert(err).Message())
+	case codes.InvalidArgument:
+		return nil, oauthError("invalid_scope", "%s", status.Convert(err).Message())
+	default:
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+	}, nil
+}
+
+func (p *OpenIDProvider) idToken(ctx context.Context, user *models.User, clientID string, code *cache.AuthCode, scopes []string) (string, error) {
+	claims, err := p.userClaims(ctx, user, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims["iss"] = p.cnf.Issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(idTokenTTL).Unix()
+	claims["auth_time"] = code.AuthTime
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	token, err := p.auth.keys.Sign(claims)
+	if err != nil {
+		log.Println("Failed to create id token: ", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// UserInfo returns the claims about the user the access token grants.
+func (p *OpenIDProvider) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, err := p.auth.Authenticate(ctx, accessToken)
+	if status.Code(err) == codes.Unauthenticated {
+		return nil, oauthError("invalid_token", "%s", status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := parseScope(claims.Scope)
+	if !slices.Contains(scopes, "openid") {
+		return nil, oauthError("insufficient_scope", "the openid scope is required")
+	}
+
+	user, err := p.auth.user.GetByID(ctx, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, oauthError("invalid_token", "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p.userClaims(ctx, user, scopes)
+}
+
+// userClaims returns the standard claims of the user that the scopes cover.
+func (p *OpenIDProvider) userClaims(ctx context.Context, user *models.User, scopes []string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{"sub": user.UserId}
+
+	if slices.Contains(scopes, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsVerified
+	}
+	// Phone numbers of users are only set by phone login, which verifies them.
+	if slices.Contains(scopes, "phone") && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = true
+	}
+
+	if slices.Contains(scopes, "profile") {
+		profile, err := p.profiles.GetByUserID(ctx, user.UserId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		name := user.Name
+		if profile != nil {
+			if full := strings.TrimSpace(profile.FirstName + " " + profile.LastName); full != "" {
+				name = full
+			}
+			setClaim(claims, "given_name", profile.FirstName)
+			setClaim(claims, "family_name", profile.LastName)
+			setClaim(claims, "picture", profile.ProfilePicture)
+		}
+		setClaim(claims, "name", name)
+
+		settings, err := p.auth.settings.GetByUserID(ctx, user.UserId)
+		if errors.Is(err, sql.ErrNoRows) {
+			settings, err = defaultSettings(user.UserId, p.auth.cnf.Settings), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		claims["locale"] = settings.Language
+		claims["zoneinfo"] = settings.TimeZone
+	}
+
+	return claims, nil
+}
+
+func setClaim(claims jwt.MapClaims, name, value string) {
+	if value != "" {
+		claims[name] = value
+	}
+}
+
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"log"
+)
+
+// comparePassword checks a password against a stored hash. needsRehash is set
+// when it matched but the hash uses an outdated algorithm or parameters.
+func (a *AuthService) comparePassword(hashedPassword, password string) (ok bool, needsRehash bool) {
+	ok, needsRehash, err := a.hasher.Verify(hashedPassword, password)
+	if err != nil {
+		log.Println("Error comparing passwords:", err)
+		return false, false
+	}
+
+	return ok, needsRehash
+}
+
+// rehashPassword replaces the stored hash with one made by the current
+// algorithm. Failing to do so doesn't affect the login, it is retried the
+// next time.
+func (a *AuthService) rehashPassword(ctx context.Context, userID, password string) {
+	hashedPassword, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Println("Failed to rehash password: ", err)
+		return
+	}
+
+	if err := a.user.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		log.Println("Failed to store rehashed password: ", err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestPasswordReset emails a reset link if the email is registered. The
+// response is the same either way, and the email is sent in the background
+// so that response times don't tell registered emails apart either.
+func (a *AuthService) RequestPasswordReset(ctx context.Context, req *auth.RequestPasswordResetRequest) (*auth.EmptyMessage, error) {
+	subjects := []string{cache.EmailSubject(req.Email)}
+	if ip := clientIP(ctx); ip != "" {
+		subjects = append(subjects, cache.IPSubject(ip))
+	}
+	for _, subject := range subjects {
+		ok, err := a.emailsender.cache.ReservePasswordReset(ctx, subject, a.cnf.Reset.ResendInterval)
+		if err != nil {
+			log.Println("Failed to check password reset cooldown: ", err)
+			return nil, err
+		}
+		if !ok {
+			return nil, codeRateLimitedError(a.cnf.Reset.ResendInterval)
+		}
+	}
+
+	user, err := a.user.GetByEmail(ctx, req.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("Password reset requested for unknown email: ", req.Email)
+		return &auth.EmptyMessage{}, nil
+	}
+	if err != nil {
+		log.Println("Unexpected error has occured: ", err)
+		return nil, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.passwordResets.Create(ctx, user.UserId, hashResetToken(token), time.Now().Add(a.cnf.Reset.TTL))
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := tokenLink(a.cnf.Reset.LinkBaseURL, token)
+	if err != nil {
+		log.Println("Invalid password reset url: ", err)
+		return nil, err
+	}
+
+	go func() {
+		if err := a.emailsender.SendPasswordResetEmail(user.Email, link, a.cnf.Reset.TTL); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) ResetPassword(ctx context.Context, req *auth.ResetPasswordRequest) (*auth.EmptyMessage, error) {
+	if err := a.checkPasswordPolicy("new_password", req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	userID, err := a.passwordResets.Consume(ctx, hashResetToken(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.InvalidArgument, "the reset link is invalid or has expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByID(ctx, userID)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return nil, err
+	}
+
+	hashedPassword, err := a.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.user.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	if err := a.passwordResets.InvalidateForUser(ctx, userID); err != nil {
+		log.Println("Failed to invalidate password resets: ", err)
+	}
+
+	if err := a.revokeAllTokens(ctx, userID, models.RevokeReasonPasswordReset); err != nil {
+		log.Println("Failed to revoke user tokens: ", err)
+		return nil, err
+	}
+
+	if err := a.loginAttempts.Reset(ctx, cache.EmailSubject(user.Email)); err != nil {
+		log.Println("Failed to reset login attempts: ", err)
+	}
+
+	err = a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    userID,
+		EventType: models.SecurityEventPasswordReset,
+		IPAddress: clientIP(ctx),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+// hashResetToken is what gets stored in password_resets. The tokens are
+// random, so a fast hash is enough to make a leaked table useless.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenLink adds the token to a page of the client app as the "token" query
+// parameter.
+func tokenLink(baseURL, token string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,140 @@
+// Package passwordpolicy checks new passwords against the configured rules
+// before they are hashed and stored.
+package passwordpolicy
+
+import (
+	"auth_service/config"
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rule identifiers reported to clients, so that apps can highlight each
+// failed rule next to the password field.
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleUppercase   = "uppercase"
+	RuleLowercase   = "lowercase"
+	RuleDigit       = "digit"
+	RuleSymbol      = "symbol"
+	RuleBlocklisted = "not_common"
+)
+
+// bcryptMaxBytes is the longest input bcrypt uses; anything after it is
+// silently ignored, so longer passwords are rejected instead.
+const bcryptMaxBytes = 72
+
+type Violation struct {
+	Rule        string
+	Description string
+	// Value is the parameter of the rule, e.g. the minimum length.
+	Value string
+}
+
+type Policy struct {
+	cnf       config.PasswordPolicyConfig
+	blocklist map[string]struct{}
+}
+
+// New creates a policy and loads the blocklist file named in the config, if any.
+func New(cnf config.PasswordPolicyConfig) (*Policy, error) {
+	if cnf.MaxBytes <= 0 || cnf.MaxBytes > bcryptMaxBytes {
+		cnf.MaxBytes = bcryptMaxBytes
+	}
+
+	p := &Policy{
+		cnf:       cnf,
+		blocklist: map[string]struct{}{},
+	}
+
+	if cnf.BlocklistFile != "" {
+		if err := p.loadBlocklist(cnf.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Check returns every rule the password breaks, or nil if it is acceptable.
+func (p *Policy) Check(password string) []Violation {
+	var violations []Violation
+
+	if n := len([]rune(password)); n < p.cnf.MinLength {
+		violations = append(violations, Violation{
+			Rule:        RuleMinLength,
+			Description: fmt.Sprintf("must be at least %d characters long", p.cnf.MinLength),
+			Value:       strconv.Itoa(p.cnf.MinLength),
+		})
+	}
+
+	if len(password) > p.cnf.MaxBytes {
+		violations = append(violations, Violation{
+			Rule:        RuleMaxLength,
+			Description: fmt.Sprintf("must not be longer than %d bytes", p.cnf.MaxBytes),
+			Value:       strconv.Itoa(p.cnf.MaxBytes),
+		})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.cnf.RequireUppercase && !upper {
+		violations = append(violations, Violation{Rule: RuleUppercase, Description: "must contain an uppercase letter"})
+	}
+	if p.cnf.RequireLowercase && !lower {
+		violations = append(violations, Violation{Rule: RuleLowercase, Description: "must contain a lowercase letter"})
+	}
+	if p.cnf.RequireDigit && !digit {
+		violations = append(violations, Violation{Rule: RuleDigit, Description: "must contain a digit"})
+	}
+	if p.cnf.RequireSymbol && !symbol {
+		violations = append(violations, Violation{Rule: RuleSymbol, Description: "must contain a symbol"})
+	}
+
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		violations = append(violations, Violation{Rule: RuleBlocklisted, Description: "is too common"})
+	}
+
+	return violations
+}
+
+// loadBlocklist reads one password per line. Empty lines and lines starting
+// with # are skipped, and entries are matched case-insensitively.
+func (p *Policy) loadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open password blocklist: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read password blocklist: %v", err)
+	}
+
+	return nil
+}
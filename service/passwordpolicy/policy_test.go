@@ -0,0 +1,126 @@
+package passwordpolicy
+
+import (
+	"auth_service/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func rules(violations []Violation) []string {
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func writeBlocklist(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		password string
+		want     []string
+	}{
+		{name: "too short", password: "short", want: []string{RuleMinLength}},
+		{name: "min length", password: "eightchr"},
+		{name: "min length counts runes", password: "пароль12"},
+		{name: "max bytes", maxBytes: 16, password: strings.Repeat("a", 16)},
+		{name: "over max bytes", maxBytes: 16, password: strings.Repeat("a", 17), want: []string{RuleMaxLength}},
+		{name: "max bytes counts bytes", maxBytes: 16, password: strings.Repeat("ж", 9), want: []string{RuleMaxLength}},
+		{name: "72 bytes", password: strings.Repeat("a", 72)},
+		{name: "over 72 bytes", password: strings.Repeat("a", 73), want: []string{RuleMaxLength}},
+		{name: "max bytes above 72", maxBytes: 100, password: strings.Repeat("a", 73), want: []string{RuleMaxLength}},
+	}
+	for _, tt := range tests {
+		p, err := New(config.PasswordPolicyConfig{MinLength: 8, MaxBytes: tt.maxBytes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rules(p.Check(tt.password)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCharacterClasses(t *testing.T) {
+	p, err := New(config.PasswordPolicyConfig{
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{password: "Abc1!"},
+		{password: "Abc1 "},
+		{password: "Пароль1€"},
+		{password: "abc1!", want: []string{RuleUppercase}},
+		{password: "ABC1!", want: []string{RuleLowercase}},
+		{password: "Abcd!", want: []string{RuleDigit}},
+		{password: "Abc12", want: []string{RuleSymbol}},
+		{password: "", want: []string{RuleUppercase, RuleLowercase, RuleDigit, RuleSymbol}},
+	}
+	for _, tt := range tests {
+		if got := rules(p.Check(tt.password)); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	// Classes that aren't required aren't reported.
+	lax, err := New(config.PasswordPolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lax.Check("abc"); got != nil {
+		t.Errorf("lax: got %v, want none", rules(got))
+	}
+}
+
+func TestCheckBlocklist(t *testing.T) {
+	path := writeBlocklist(t, "# common passwords", "", "Password1", "  qwerty123  ")
+	p, err := New(config.PasswordPolicyConfig{BlocklistFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{password: "password1", want: []string{RuleBlocklisted}},
+		{password: "PASSWORD1", want: []string{RuleBlocklisted}},
+		{password: "QwErTy123", want: []string{RuleBlocklisted}},
+		{password: "password12"},
+		{password: "# common passwords"},
+	}
+	for _, tt := range tests {
+		if got := rules(p.Check(tt.password)); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestMissingBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.txt")
+	if _, err := New(config.PasswordPolicyConfig{BlocklistFile: path}); err == nil {
+		t.Error("got no error for a missing blocklist file")
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"auth_service/pkg/clientip"
+	"context"
+	"net"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientIP returns the address of the end user. The server resolves it when
+// the call comes in, believing forwarding headers only from trusted proxies;
+// see clientip.Resolver. Without it, the address of the gRPC peer is used.
+func clientIP(ctx context.Context) string {
+	if ip, ok := clientip.FromContext(ctx); ok {
+		return ip
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// ContextWithClient passes the address and user agent of the end user, for
+// calls that don't come in over gRPC. ip must already be resolved.
+func ContextWithClient(ctx context.Context, ip, userAgent string) context.Context {
+	ctx = clientip.NewContext(ctx, ip)
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("x-user-agent", userAgent))
+}
+
+// userAgentFromContext returns the user agent of the end user's app as forwarded by the
+// API gateway, or the one of the gRPC client.
+func userAgentFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, key := range []string{"x-user-agent", "user-agent"} {
+		if v := md.Get(key); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+
+	return ""
+}
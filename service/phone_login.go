@@ -0,0 +1,143 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StartPhoneLogin texts a login code to the number. It behaves the same for
+// known and unknown numbers.
+func (a *AuthService) StartPhoneLogin(ctx context.Context, req *auth.StartPhoneLoginRequest) (*auth.StartPhoneLoginResponse, error) {
+	if !phoneNumberPattern.MatchString(req.PhoneNumber) {
+		return nil, status.Error(codes.InvalidArgument, "phone number must be in E.164 format, e.g. +998901234567")
+	}
+
+	retryAfter, err := a.phoneCodes.ReserveSend(ctx, req.PhoneNumber, clientIP(ctx))
+	if err != nil {
+		log.Println("Failed to check phone code limits: ", err)
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, codeRateLimitedError(retryAfter)
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.phoneCodes.SaveCode(ctx, req.PhoneNumber, hashPhoneCode(code)); err != nil {
+		log.Println("Failed to save phone code: ", err)
+		return nil, err
+	}
+
+	ttl := a.cnf.PhoneLogin.CodeTTL
+	body := fmt.Sprintf("%s code: %s. It expires in %d minutes. Don't share it with anyone.", a.cnf.Mfa.Issuer, code, int(ttl.Minutes()))
+	if err := a.sms.Send(ctx, req.PhoneNumber, body); err != nil {
+		log.Println("Failed to send phone code: ", err)
+		return nil, status.Error(codes.Unavailable, "couldn't send the code, try again later")
+	}
+
+	return &auth.StartPhoneLoginResponse{ExpiresIn: int64(ttl.Seconds())}, nil
+}
+
+// CompletePhoneLogin checks the code and logs the user in, creating the
+// account if the number is new. Each code is good for one login and
+// PhoneLoginConfig.MaxAttempts tries.
+func (a *AuthService) CompletePhoneLogin(ctx context.Context, req *auth.CompletePhoneLoginRequest) (*auth.LoginResponse, error) {
+	if !phoneNumberPattern.MatchString(req.PhoneNumber) {
+		return nil, status.Error(codes.InvalidArgument, "phone number must be in E.164 format, e.g. +998901234567")
+	}
+
+	if err := a.checkPhoneCode(ctx, req.PhoneNumber, req.Code); err != nil {
+		return nil, err
+	}
+
+	user, err := a.user.GetByPhone(ctx, req.PhoneNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		var created bool
+		user, created, err = a.user.CreatePhoneUser(ctx, req.PhoneNumber)
+		if err == nil && created {
+			err = a.setUpNewUser(ctx, user.UserId)
+		}
+	}
+	if err != nil {
+		log.Println("Failed to get user by phone: ", err)
+		return nil, err
+	}
+
+	return a.completeLogin(ctx, user.UserId, req.DeviceName, req.ClientId, req.Scopes)
+}
+
+// checkPhoneCode verifies and uses up the code sent to the number. The
+// attempt is counted before the code is compared.
+func (a *AuthService) checkPhoneCode(ctx context.Context, phone, code string) error {
+	attempts, err := a.phoneCodes.RegisterAttempt(ctx, phone)
+	if err != nil {
+		log.Println("Failed to count phone code attempt: ", err)
+		return err
+	}
+	left := a.cnf.PhoneLogin.MaxAttempts - int(attempts)
+	if left < 0 {
+		if _, err := a.phoneCodes.DeleteCode(ctx, phone); err != nil {
+			log.Println("Failed to delete phone code: ", err)
+		}
+		return invalidCodeError(0)
+	}
+
+	hash, err := a.phoneCodes.GetCode(ctx, phone)
+	if err != nil {
+		log.Println("Failed to get phone code: ", err)
+		return err
+	}
+	if hash == "" {
+		return invalidCodeError(0)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashPhoneCode(code))) != 1 {
+		if left == 0 {
+			if _, err := a.phoneCodes.DeleteCode(ctx, phone); err != nil {
+				log.Println("Failed to delete phone code: ", err)
+			}
+		}
+		return invalidCodeError(left)
+	}
+
+	used, err := a.phoneCodes.DeleteCode(ctx, phone)
+	if err != nil {
+		log.Println("Failed to delete phone code: ", err)
+		return err
+	}
+	if !used {
+		// Another request with the same code got there first.
+		return invalidCodeError(0)
+	}
+
+	return nil
+}
+
+// newPhoneCode returns a random 6-digit code.
+func newPhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashPhoneCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
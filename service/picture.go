@@ -0,0 +1,173 @@
+package service
+
+import (
+	"auth_service/genproto/user"
+	"auth_service/models"
+	"auth_service/pkg/imagemeta"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pictureExtensions are the accepted content types of profile pictures.
+var pictureExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// UploadProfilePicture stores the streamed image without its metadata and
+// makes it the profile picture. The previous picture is deleted if it was
+// uploaded here.
+func (u *UserService) UploadProfilePicture(stream user.UserService_UploadProfilePictureServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the picture info")
+	}
+
+	userID, err := u.authorizeUser(ctx, info.UserId)
+	if err != nil {
+		return err
+	}
+	ext, ok := pictureExtensions[info.ContentType]
+	if !ok {
+		return status.Error(codes.InvalidArgument, "content type must be image/jpeg or image/png")
+	}
+
+	data, err := u.receivePicture(stream)
+	if err != nil {
+		return err
+	}
+	if data, err = u.cleanPicture(info.ContentType, data); err != nil {
+		return err
+	}
+
+	if err := u.checkUserExists(ctx, userID); err != nil {
+		return err
+	}
+
+	name, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	key := pictureKeyPrefix(userID) + name + ext
+	url, err := u.blobs.Put(ctx, key, data, info.ContentType)
+	if err != nil {
+		log.Println("Failed to store profile picture: ", err)
+		return err
+	}
+
+	previous, err := u.setProfilePicture(ctx, userID, url)
+	if err != nil {
+		u.deletePicture(ctx, userID, url)
+		return err
+	}
+	u.deletePicture(ctx, userID, previous)
+
+	return stream.SendAndClose(&user.UploadProfilePictureResponse{ProfilePicture: url})
+}
+
+// receivePicture reads the chunks that follow the info message.
+func (u *UserService) receivePicture(stream user.UserService_UploadProfilePictureServer) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := req.GetChunk()
+		if chunk == nil {
+			return nil, status.Error(codes.InvalidArgument, "only the first message may carry the picture info")
+		}
+		if buf.Len()+len(chunk) > u.cnf.Profile.PictureMaxBytes {
+			return nil, status.Errorf(codes.InvalidArgument, "picture exceeds %d bytes", u.cnf.Profile.PictureMaxBytes)
+		}
+		buf.Write(chunk)
+	}
+
+	if buf.Len() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "picture is empty")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cleanPicture checks that the data is an image of the declared type and
+// strips its metadata.
+func (u *UserService) cleanPicture(contentType string, data []byte) ([]byte, error) {
+	if http.DetectContentType(data) != contentType {
+		return nil, status.Errorf(codes.InvalidArgument, "picture is not of type %s", contentType)
+	}
+
+	cnf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || pictureExtensions["image/"+format] == "" {
+		return nil, status.Error(codes.InvalidArgument, "picture can't be decoded")
+	}
+	if cnf.Width <= 0 || cnf.Height <= 0 || cnf.Width*cnf.Height > u.cnf.Profile.PictureMaxPixels {
+		return nil, status.Errorf(codes.InvalidArgument, "picture must have at most %d pixels", u.cnf.Profile.PictureMaxPixels)
+	}
+
+	stripped, err := imagemeta.Strip(contentType, data)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "picture is malformed")
+	}
+
+	return stripped, nil
+}
+
+// setProfilePicture stores the URL on the profile and returns the one it
+// replaced.
+func (u *UserService) setProfilePicture(ctx context.Context, userID, url string) (string, error) {
+	profile, err := u.profiles.GetByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		profile = &models.UserProfile{UserID: userID}
+	} else if err != nil {
+		return "", err
+	}
+
+	previous := profile.ProfilePicture
+	profile.ProfilePicture = url
+	if err := u.profiles.Upsert(ctx, profile); err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// deletePicture removes a picture the user uploaded. URLs set with
+// UpdateUserProfile may point anywhere, even at another user's picture, so
+// only keys under the user's own prefix are deleted.
+func (u *UserService) deletePicture(ctx context.Context, userID, url string) {
+	key, ok := u.blobs.Key(url)
+	if !ok || !strings.HasPrefix(key, pictureKeyPrefix(userID)) {
+		return
+	}
+
+	if err := u.blobs.Delete(ctx, key); err != nil {
+		log.Println("Failed to delete profile picture: ", err)
+	}
+}
+
+func pictureKeyPrefix(userID string) string {
+	return "profile-pictures/" + userID + "/"
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// randomToken returns n random bytes encoded for use in URLs and metadata.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easy to misread.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+func (a *AuthService) RegenerateRecoveryCodes(ctx context.Context, req *auth.RegenerateRecoveryCodesRequest) (*auth.RecoveryCodesResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := a.twoFactor.GetByUserID(ctx, claims.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+	}
+
+	ok, err := a.verifyTOTP(ctx, twoFactor, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid verification code")
+	}
+
+	recoveryCodes, err := a.newRecoveryCodes(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (a *AuthService) GetRecoveryCodesStatus(ctx context.Context, req *auth.EmptyMessage) (*auth.RecoveryCodesStatusResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := a.recoveryCodes.CountUnused(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.RecoveryCodesStatusResponse{Remaining: int32(remaining)}, nil
+}
+
+// newRecoveryCodes replaces the recovery codes of the user and returns the
+// new codes in plain text. Only their hashes are stored.
+func (a *AuthService) newRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	if err := a.recoveryCodes.ReplaceCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// useRecoveryCode consumes a matching unused code of the user. It records a
+// security event and notifies the user by email when a code is used.
+func (a *AuthService) useRecoveryCode(ctx context.Context, userID, code string) (bool, error) {
+	ok, err := a.recoveryCodes.Use(ctx, userID, hashRecoveryCode(code))
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    userID,
+		EventType: models.SecurityEventRecoveryCodeUsed,
+		IPAddress: clientIP(ctx),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+
+	go a.sendRecoveryCodeUsedEmail(context.WithoutCancel(ctx), userID)
+
+	return true, nil
+}
+
+// sendRecoveryCodeUsedEmail tells the user a recovery code was used, unless
+// they have no email, as users who signed up by phone.
+func (a *AuthService) sendRecoveryCodeUsedEmail(ctx context.Context, userID string) {
+	user, err := a.user.GetByID(ctx, userID)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return
+	}
+	if user.Email == "" {
+		return
+	}
+
+	remaining, err := a.recoveryCodes.CountUnused(ctx, userID)
+	if err != nil {
+		log.Println("Failed to count recovery codes: ", err)
+		return
+	}
+	if err := a.emailsender.SendRecoveryCodeUsedEmail(user.Email, remaining); err != nil {
+		log.Println(err)
+	}
+}
+
+func randomRecoveryCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeLength; i++ {
+		if i == recoveryCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// hashRecoveryCode is what gets stored in recovery_codes. The codes are
+// random, so like reset tokens they only need a fast hash, which lets a code
+// be looked up by its hash.
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeRecoveryCode lets users type codes without the dash, with spaces
+// or in upper case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (a *AuthService) GrantRole(ctx context.Context, req *auth.RoleRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkRoleRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	granted, err := a.roles.Grant(ctx, req.UserId, req.Role, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if granted {
+		a.roleEvent(ctx, models.SecurityEventRoleGranted, req, claims.UserID)
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+// RevokeRole takes the role away and revokes every token of the user, since
+// access tokens would keep the role until they expire otherwise.
+func (a *AuthService) RevokeRole(ctx context.Context, req *auth.RoleRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkRoleRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	if req.UserId == claims.UserID && req.Role == models.RoleAdmin {
+		return nil, status.Error(codes.FailedPrecondition, "admins can't revoke their own admin role")
+	}
+
+	revoked, err := a.roles.Revoke(ctx, req.UserId, req.Role)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, status.Error(codes.NotFound, "user doesn't have the role")
+	}
+
+	if err := a.revokeAllTokens(ctx, req.UserId, models.RevokeReasonRoleRevoked); err != nil {
+		log.Println("Token Revocation failed: ", err)
+		return nil, err
+	}
+	a.roleEvent(ctx, models.SecurityEventRoleRevoked, req, claims.UserID)
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) ListUserRoles(ctx context.Context, req *auth.ListUserRolesRequest) (*auth.ListUserRolesResponse, error) {
+	if _, err := a.authenticateAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	roles, err := a.roles.ListForUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.ListUserRolesResponse{Roles: roles}, nil
+}
+
+func (a *AuthService) checkRoleRequest(ctx context.Context, req *auth.RoleRequest) error {
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	exists, err := a.roles.Exists(ctx, req.Role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return status.Errorf(codes.InvalidArgument, "unknown role %q", req.Role)
+	}
+
+	if _, err := a.user.GetByID(ctx, req.UserId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status.Error(codes.NotFound, "user not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (a *AuthService) roleEvent(ctx context.Context, eventType string, req *auth.RoleRequest, adminID string) {
+	err := a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    req.UserId,
+		EventType: eventType,
+		IPAddress: clientIP(ctx),
+		Details:   fmt.Sprintf("role=%s admin_id=%s", req.Role, adminID),
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+}
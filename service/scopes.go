@@ -0,0 +1,106 @@
+package service
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grantScopes works out what a new login gets: the requested scopes that the
+// roles of the user and the client allow, or all of those if none were
+// requested.
+func (a *AuthService) grantScopes(ctx context.Context, userID, clientID string, requested []string) ([]string, error) {
+	allowed, err := a.allowedScopes(ctx, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	granted := intersectScopes(requested, allowed)
+	if len(granted) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "none of the requested scopes can be granted")
+	}
+
+	return granted, nil
+}
+
+// refreshScopes works out the scopes of the access token issued by a refresh.
+// Requested scopes may narrow what the login was granted, but not widen it.
+func (a *AuthService) refreshScopes(ctx context.Context, claims *models.Claims, requested []string) ([]string, error) {
+	allowed, err := a.allowedScopes(ctx, claims.UserID, claims.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The login keeps what it was granted, and loses what the user's roles
+	// no longer allow. Roles added since don't widen it, even if the login
+	// asked for no scopes and so got all the user had then.
+	granted := intersectScopes(parseScope(claims.Scope), allowed)
+	if len(requested) == 0 {
+		return granted, nil
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			return nil, status.Errorf(codes.InvalidArgument, "scope %q wasn't granted to this login", scope)
+		}
+	}
+
+	return intersectScopes(requested, granted), nil
+}
+
+// openIDScopes are the OpenID Connect scopes for the identity of the user.
+// Every user has them; clients get those they are registered with.
+var openIDScopes = []string{"openid", "profile", "email", "phone"}
+
+// allowedScopes returns the scopes of all roles of the user, limited to those
+// of the client when there is one.
+func (a *AuthService) allowedScopes(ctx context.Context, userID, clientID string) ([]string, error) {
+	allowed, err := a.scopes.AllowedForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if clientID == "" {
+		return allowed, nil
+	}
+	allowed = slices.Concat(openIDScopes, allowed)
+
+	clientScopes, err := a.scopes.AllowedForClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown client %q", clientID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return intersectScopes(allowed, clientScopes), nil
+}
+
+// intersectScopes returns the scopes of a that are in b, in the order of a
+// and without duplicates.
+func intersectScopes(a, b []string) []string {
+	scopes := []string{}
+	for _, scope := range a {
+		if slices.Contains(b, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+func parseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
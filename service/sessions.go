@@ -0,0 +1,126 @@
+package service
+
+import (
+	"auth_service/genproto/auth"
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (a *AuthService) ListSessions(ctx context.Context, req *auth.EmptyMessage) (*auth.ListSessionsResponse, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := a.tokens.ListSessions(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &auth.ListSessionsResponse{}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, &auth.Session{
+			SessionId:  s.SessionID,
+			DeviceName: s.DeviceName,
+			UserAgent:  s.UserAgent,
+			IpAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+			LastUsedAt: s.LastUsedAt.Format(time.RFC3339),
+			Current:    s.SessionID == claims.FamilyID,
+		})
+	}
+
+	return resp, nil
+}
+
+func (a *AuthService) RevokeSession(ctx context.Context, req *auth.RevokeSessionRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(req.SessionId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid session id")
+	}
+
+	jtis, err := a.tokens.RevokeUserFamily(ctx, claims.UserID, req.SessionId, models.RevokeReasonLogout)
+	if err != nil {
+		log.Println("Token Revocation failed: ", err)
+		return nil, err
+	}
+	if len(jtis) == 0 {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	if err := a.familyRevoked(ctx, req.SessionId, jtis, models.RevokeReasonLogout); err != nil {
+		log.Println("Token Revocation failed: ", err)
+		return nil, err
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) LogOutAll(ctx context.Context, req *auth.EmptyMessage) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.logOutAll(ctx, claims.UserID, ""); err != nil {
+		return nil, err
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) AdminLogOutAll(ctx context.Context, req *auth.AdminLogOutAllRequest) (*auth.EmptyMessage, error) {
+	claims, err := a.authenticateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	if _, err := a.user.GetByID(ctx, req.UserId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, err
+	}
+
+	if err := a.logOutAll(ctx, req.UserId, fmt.Sprintf("admin_id=%s", claims.UserID)); err != nil {
+		return nil, err
+	}
+
+	return &auth.EmptyMessage{}, nil
+}
+
+func (a *AuthService) logOutAll(ctx context.Context, userID, details string) error {
+	if err := a.revokeAllTokens(ctx, userID, models.RevokeReasonLogoutAll); err != nil {
+		log.Println("Token Revocation failed: ", err)
+		return err
+	}
+
+	err := a.securityEvents.Create(ctx, &models.SecurityEvent{
+		UserID:    userID,
+		EventType: models.SecurityEventLogoutAll,
+		IPAddress: clientIP(ctx),
+		Details:   details,
+	})
+	if err != nil {
+		log.Println("Failed to record security event: ", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"auth_service/config"
+	"auth_service/genproto/user"
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetUserSettings returns the defaults for users without stored settings.
+func (u *UserService) GetUserSettings(ctx context.Context, req *user.GetUserSettingsRequest) (*user.GetUserSettingsResponse, error) {
+	userID, err := u.authorizeUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := u.userSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.GetUserSettingsResponse{
+		Language:                settings.Language,
+		TimeZone:                settings.TimeZone,
+		NotificationPreferences: settings.NotificationPreferences,
+	}, nil
+}
+
+// UpdateUserSettings changes the fields that are set and keeps the rest.
+func (u *UserService) UpdateUserSettings(ctx context.Context, req *user.UpdateUserSettingsRequest) (*user.UpdateUserSettingsResponse, error) {
+	userID, err := u.authorizeUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := u.userSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	violation := func(field, description string) {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+
+	if req.Language != "" {
+		if !supportedLanguage(u.cnf.Settings.Languages, req.Language) {
+			violation("language", fmt.Sprintf("must be one of %v", u.cnf.Settings.Languages))
+		}
+		settings.Language = req.Language
+	}
+	if req.TimeZone != "" {
+		if !validTimeZone(req.TimeZone) {
+			violation("time_zone", "must be an IANA time zone, e.g. Asia/Tashkent")
+		}
+		settings.TimeZone = req.TimeZone
+	}
+	if req.NotificationPreferences != "" {
+		prefs, err := parseNotificationPreferences(req.NotificationPreferences)
+		if err != nil {
+			violation("notification_preferences", err.Error())
+		}
+		settings.NotificationPreferences = prefs
+	}
+
+	if len(badRequest.FieldViolations) > 0 {
+		return nil, withDetails(status.New(codes.InvalidArgument, "invalid settings"), badRequest)
+	}
+
+	if err := u.settings.Upsert(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	return &user.UpdateUserSettingsResponse{Message: "Settings updated successfully"}, nil
+}
+
+// userSettings returns the settings of a user with every notification event
+// filled in.
+func (u *UserService) userSettings(ctx context.Context, userID string) (*models.UserSettings, error) {
+	settings, err := u.settings.GetByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := u.checkUserExists(ctx, userID); err != nil {
+			return nil, err
+		}
+		return defaultSettings(userID, u.cnf.Settings), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := parseNotificationPreferences(settings.NotificationPreferences)
+	if err != nil {
+		log.Printf("Invalid stored notification preferences of %s: %v", userID, err)
+		prefs = formatNotificationPreferences(models.DefaultNotificationPreferences())
+	}
+	settings.NotificationPreferences = prefs
+
+	return settings, nil
+}
+
+func defaultSettings(userID string, cnf config.UserSettingsConfig) *models.UserSettings {
+	return &models.UserSettings{
+		UserID:                  userID,
+		Language:                cnf.DefaultLanguage,
+		TimeZone:                cnf.DefaultTimeZone,
+		NotificationPreferences: formatNotificationPreferences(models.DefaultNotificationPreferences()),
+	}
+}
+
+// supportedLanguage reports whether the tag is one of the configured
+// languages, spelled the same way.
+func supportedLanguage(languages []string, tag string) bool {
+	return tag != "" && slices.Contains(languages, tag)
+}
+
+// validTimeZone accepts IANA names only; time.LoadLocation also takes ""
+// and "Local", which depend on the server.
+func validTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// parseNotificationPreferences validates preferences against the schema of
+// models.NotificationPreferences and returns them in canonical form, with
+// events that were left out set to their defaults.
+func parseNotificationPreferences(raw string) (string, error) {
+	var prefs models.NotificationPreferences
+	if err := json.Unmarshal([]byte(raw), &prefs); err != nil {
+		return "", errors.New(`must be a JSON object of event types to channel lists, e.g. {"order_status": ["push"]}`)
+	}
+
+	merged := models.DefaultNotificationPreferences()
+	for event, channels := range prefs {
+		if !slices.Contains(models.NotificationEvents, event) {
+			return "", fmt.Errorf("unknown event %q, expected one of %v", event, models.NotificationEvents)
+		}
+
+		seen := make(map[string]bool, len(channels))
+		for _, channel := range channels {
+			if !slices.Contains(models.NotificationChannels, channel) {
+				return "", fmt.Errorf("unknown channel %q for %s, expected one of %v", channel, event, models.NotificationChannels)
+			}
+			if seen[channel] {
+				return "", fmt.Errorf("duplicate channel %q for %s", channel, event)
+			}
+			seen[channel] = true
+		}
+
+		if channels == nil {
+			channels = []string{}
+		}
+		merged[event] = channels
+	}
+
+	return formatNotificationPreferences(merged), nil
+}
+
+func formatNotificationPreferences(prefs models.NotificationPreferences) string {
+	// Maps are encoded with sorted keys, so equal preferences encode equally.
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		log.Println("Failed to marshal notification preferences: ", err)
+		return "{}"
+	}
+
+	return string(data)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	// Like the server, the tests don't rely on a system time zone database.
+	_ "time/tzdata"
+)
+
+func TestParseNotificationPreferences(t *testing.T) {
+	defaults := `{"delivery":["push"],"order_status":["push"],"promotions":["email"],"security":["email"]}`
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		invalid bool
+	}{
+		{name: "empty object", raw: `{}`, want: defaults},
+		{
+			name: "overrides one event",
+			raw:  `{"promotions": ["sms", "push"]}`,
+			want: `{"delivery":["push"],"order_status":["push"],"promotions":["sms","push"],"security":["email"]}`,
+		},
+		{
+			name: "empty list turns an event off",
+			raw:  `{"promotions": []}`,
+			want: `{"delivery":["push"],"order_status":["push"],"promotions":[],"security":["email"]}`,
+		},
+		{
+			name: "null turns an event off",
+			raw:  `{"promotions": null}`,
+			want: `{"delivery":["push"],"order_status":["push"],"promotions":[],"security":["email"]}`,
+		},
+		{name: "unknown channel", raw: `{"delivery": ["pigeon"]}`, invalid: true},
+		{name: "channels are case sensitive", raw: `{"delivery": ["Push"]}`, invalid: true},
+		{name: "duplicate channel", raw: `{"delivery": ["push", "sms", "push"]}`, invalid: true},
+		{name: "unknown event", raw: `{"newsletter": ["email"]}`, invalid: true},
+		{name: "not an object", raw: `["push"]`, invalid: true},
+		{name: "channels not a list", raw: `{"delivery": "push"}`, invalid: true},
+		{name: "malformed", raw: `{"delivery": [`, invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := parseNotificationPreferences(tt.raw)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidTimeZone(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "Asia/Tashkent", want: true},
+		{name: "America/Argentina/Buenos_Aires", want: true},
+		{name: "UTC", want: true},
+		{name: "", want: false},
+		{name: "Local", want: false},
+		{name: "Mars/Olympus_Mons", want: false},
+		{name: "+05:00", want: false},
+		{name: "../../etc/passwd", want: false},
+	}
+	for _, tt := range tests {
+		if got := validTimeZone(tt.name); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSupportedLanguage(t *testing.T) {
+	languages := []string{"en", "ru", "uz"}
+
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{tag: "en", want: true},
+		{tag: "uz", want: true},
+		{tag: "de", want: false},
+		{tag: "en-US", want: false},
+		{tag: "english", want: false},
+		{tag: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := supportedLanguage(languages, tt.tag); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"auth_service/models"
+	"auth_service/pkg/jwtkeys"
+	"auth_service/storage/postgres"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLastSigningKey is returned for a retirement that would leave no key to
+// sign with.
+var ErrLastSigningKey = errors.New("no other key signs after the retirement, add one first")
+
+// SigningKeys keeps the keyring tokens are signed with in line with the keys
+// stored in Postgres, which every instance of the service shares. Postgres
+// only has the public keys; the private ones are read from the PEM files in
+// dir.
+type SigningKeys struct {
+	store   *postgres.SigningKeyImpl
+	keyring *jwtkeys.Keyring
+	dir     string
+}
+
+func NewSigningKeys(store *postgres.SigningKeyImpl, keyring *jwtkeys.Keyring, dir string) *SigningKeys {
+	return &SigningKeys{
+		store:   store,
+		keyring: keyring,
+		dir:     dir,
+	}
+}
+
+// Reload replaces the keyring with the keys that aren't retired. Keys whose
+// file is missing only verify.
+func (s *SigningKeys) Reload(ctx context.Context) error {
+	stored, err := s.store.ListUsable(ctx)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*jwtkeys.Key, 0, len(stored))
+	for _, sk := range stored {
+		key, ok := files[sk.KID]
+		if !ok {
+			if key, err = jwtkeys.ParsePublicKey([]byte(sk.PublicKey)); err != nil {
+				log.Printf("Skipping signing key %s: %v", sk.KID, err)
+				continue
+			}
+		}
+		key.NotBefore = sk.ActivatesAt
+		if sk.RetireAt != nil {
+			key.RetireAt = *sk.RetireAt
+		}
+		keys = append(keys, key)
+	}
+	s.keyring.Replace(keys)
+
+	return nil
+}
+
+// files returns the private keys in the key directory by ID.
+func (s *SigningKeys) files() (map[string]*jwtkeys.Key, error) {
+	keys, err := jwtkeys.LoadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %v", err)
+	}
+
+	files := make(map[string]*jwtkeys.Key, len(keys))
+	for _, key := range keys {
+		files[key.ID] = key
+	}
+
+	return files, nil
+}
+
+// Watch reloads the keyring every interval until ctx is done, so that keys
+// added or retired with cmd/keys reach every instance.
+func (s *SigningKeys) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil {
+				log.Println("Failed to reload signing keys: ", err)
+			}
+		}
+	}
+}
+
+// Add writes the private key to the key directory, unless it is there
+// already, and stores its public key to start signing at activatesAt.
+func (s *SigningKeys) Add(ctx context.Context, key *jwtkeys.Key, activatesAt time.Time) (*models.SigningKey, error) {
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(s.dir, key.ID+".pem")
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write signing key: %v", err)
+		}
+	}
+
+	return s.register(ctx, key, activatesAt)
+}
+
+// Import stores the public keys of the files in the key directory when there
+// are no keys at all yet, active right away. It is for the first start.
+func (s *SigningKeys) Import(ctx context.Context) ([]*models.SigningKey, error) {
+	stored, err := s.store.ListUsable(ctx)
+	if err != nil || len(stored) > 0 {
+		return nil, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var imported []*models.SigningKey
+	for _, key := range files {
+		sk, err := s.register(ctx, key, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, sk)
+	}
+
+	return imported, nil
+}
+
+func (s *SigningKeys) register(ctx context.Context, key *jwtkeys.Key, activatesAt time.Time) (*models.SigningKey, error) {
+	public, err := key.MarshalPublicPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	sk := &models.SigningKey{
+		KID:         key.ID,
+		Algorithm:   key.Method.Alg(),
+		PublicKey:   string(public),
+		ActivatesAt: activatesAt,
+	}
+	if err := s.store.Create(ctx, sk); err != nil {
+		return nil, err
+	}
+
+	return sk, nil
+}
+
+// Retire stops the key from verifying tokens at the given time. Tokens it
+// signed before are rejected from then on. It fails with ErrLastSigningKey
+// unless another key signs by then and isn't retired before.
+func (s *SigningKeys) Retire(ctx context.Context, kid string, at time.Time) error {
+	stored, err := s.store.ListUsable(ctx)
+	if err != nil {
+		return err
+	}
+
+	found, replaced := false, false
+	for _, sk := range stored {
+		if sk.KID == kid {
+			found = true
+			continue
+		}
+		if sk.ActivatesAt.Before(at) && (sk.RetireAt == nil || sk.RetireAt.After(at)) {
+			replaced = true
+		}
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	if !replaced {
+		return ErrLastSigningKey
+	}
+
+	return s.store.Retire(ctx, kid, at)
+}
+
+func (s *SigningKeys) List(ctx context.Context) ([]*models.SigningKey, error) {
+	return s.store.ListUsable(ctx)
+}
@@ -1 +1,259 @@
 package service
+
+import (
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 5 * time.Hour
+	refreshTokenTTL = 24 * time.Hour
+)
+
+// tokenPair is what a successful login or refresh hands out.
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// issueTokens starts a new refresh token family for the user and stores its
+// first refresh token together with the device it was issued to. The scope
+// and client of the login are taken from token. If token.FamilyID is set the
+// tokens continue that family instead, as after a password change.
+func (a *AuthService) issueTokens(ctx context.Context, userID string, token *models.Token) (*tokenPair, error) {
+	now := time.Now()
+	token.JTI = uuid.NewString()
+	token.UserID = userID
+	if token.FamilyID == "" {
+		token.FamilyID = uuid.NewString()
+	}
+	token.CreatedAt = now
+	token.ExpiresAt = now.Add(refreshTokenTTL)
+
+	generation, err := a.tokenGeneration(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	token.Generation = generation
+
+	roles, err := a.roles.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := a.newAccessToken(token, roles, token.Scope, now)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := a.newRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.tokens.Create(ctx, token); err != nil {
+		log.Println("Failed to store refresh token: ", err)
+		return nil, err
+	}
+	a.cacheTokenStatus(ctx, token.JTI, cache.TokenStatusActive, token.ExpiresAt)
+
+	return &tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// newAccessToken issues an access token for the login the refresh token
+// belongs to. scope is the one of the refresh token or narrower.
+func (a *AuthService) newAccessToken(refresh *models.Token, roles []string, scope string, now time.Time) (string, error) {
+	token, err := a.signToken(models.Claims{
+		UserID:     refresh.UserID,
+		TokenType:  models.TokenTypeAccess,
+		FamilyID:   refresh.FamilyID,
+		Generation: refresh.Generation,
+		Roles:      roles,
+		Scope:      scope,
+		ClientID:   refresh.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	})
+	if err != nil {
+		log.Println("Failed to create access token: ", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (a *AuthService) newRefreshToken(token *models.Token) (string, error) {
+	signed, err := a.signToken(models.Claims{
+		UserID:     token.UserID,
+		TokenType:  models.TokenTypeRefresh,
+		FamilyID:   token.FamilyID,
+		Generation: token.Generation,
+		Scope:      token.Scope,
+		ClientID:   token.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        token.JTI,
+			IssuedAt:  jwt.NewNumericDate(token.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+		},
+	})
+	if err != nil {
+		log.Println("Failed to create refresh token: ", err)
+		return "", err
+	}
+
+	return signed, nil
+}
+
+func (a *AuthService) signToken(claims models.Claims) (string, error) {
+	return a.keys.Sign(claims)
+}
+
+// extractClaims verifies the token and returns its claims.
+func (a *AuthService) extractClaims(token string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	if err := a.keys.Parse(token, claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims: %v", err)
+	}
+
+	return claims, nil
+}
+
+// refreshTokenStatus returns cache.TokenStatusActive or the revoke reason of
+// a refresh token, reading it from Postgres when it isn't cached.
+func (a *AuthService) refreshTokenStatus(ctx context.Context, jti string) (string, error) {
+	status, err := a.tokenCache.GetTokenStatus(ctx, jti)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+	}
+	if status != "" {
+		return status, nil
+	}
+
+	token, err := a.tokens.GetByJTI(ctx, jti)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "unknown", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	status = cache.TokenStatusActive
+	if token.IsRevoked {
+		status = token.RevokeReason
+	}
+	a.cacheTokenStatus(ctx, jti, status, token.ExpiresAt)
+
+	return status, nil
+}
+
+// revokeFamily revokes every refresh token of one login.
+func (a *AuthService) revokeFamily(ctx context.Context, familyID, reason string) error {
+	jtis, err := a.tokens.RevokeFamily(ctx, familyID, reason)
+	if err != nil {
+		return err
+	}
+
+	return a.familyRevoked(ctx, familyID, jtis, reason)
+}
+
+// familyRevoked brings the cache in line after the tokens of a family were
+// revoked in Postgres. Access tokens of the family are cut off too, not only
+// its refresh tokens.
+func (a *AuthService) familyRevoked(ctx context.Context, familyID string, jtis []string, reason string) error {
+	for _, jti := range jtis {
+		a.cacheTokenStatus(ctx, jti, reason, time.Now().Add(refreshTokenTTL))
+	}
+
+	return a.tokenCache.RevokeSession(ctx, familyID, reason, accessTokenTTL)
+}
+
+// revokeOtherSessions revokes every login of the user but the caller's, so
+// that other devices have to sign in again after a change to the account.
+func (a *AuthService) revokeOtherSessions(ctx context.Context, claims *models.Claims, reason string) error {
+	families, err := a.tokens.RevokeOtherFamilies(ctx, claims.UserID, claims.FamilyID, reason)
+	if err != nil {
+		return err
+	}
+
+	for familyID, jtis := range families {
+		if err := a.familyRevoked(ctx, familyID, jtis, reason); err != nil {
+			log.Println("Redis Error: ", err)
+		}
+	}
+
+	return nil
+}
+
+// revokeAllTokens revokes every refresh token of the user, and every access
+// token issued so far by moving the user to a new token generation.
+func (a *AuthService) revokeAllTokens(ctx context.Context, userID, reason string) error {
+	generation, err := a.user.IncrementTokenGeneration(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := a.tokenCache.SetTokenGeneration(ctx, userID, generation); err != nil {
+		log.Println("Redis Error: ", err)
+	}
+
+	jtis, err := a.tokens.RevokeAllForUser(ctx, userID, reason)
+	if err != nil {
+		return err
+	}
+
+	for _, jti := range jtis {
+		a.cacheTokenStatus(ctx, jti, reason, time.Now().Add(refreshTokenTTL))
+	}
+
+	return nil
+}
+
+// tokenGeneration returns the current token generation of the user, reading
+// it from Postgres when it isn't cached.
+func (a *AuthService) tokenGeneration(ctx context.Context, userID string) (int64, error) {
+	generation, ok, err := a.tokenCache.GetTokenGeneration(ctx, userID)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+	}
+	if ok {
+		return generation, nil
+	}
+
+	generation, err = a.user.GetTokenGeneration(ctx, userID)
+	if err != nil {
+		log.Println("Failed to get token generation: ", err)
+		return 0, err
+	}
+	if err := a.tokenCache.SetTokenGeneration(ctx, userID, generation); err != nil {
+		log.Println("Redis Error: ", err)
+	}
+
+	return generation, nil
+}
+
+// staleGeneration reports whether the token was issued before the user's
+// tokens were last revoked all at once.
+func (a *AuthService) staleGeneration(ctx context.Context, claims *models.Claims) (bool, error) {
+	generation, err := a.tokenGeneration(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	return claims.Generation < generation, nil
+}
+
+func (a *AuthService) cacheTokenStatus(ctx context.Context, jti, status string, until time.Time) {
+	if err := a.tokenCache.SetTokenStatus(ctx, jti, status, time.Until(until)); err != nil {
+		log.Println("Redis Error: ", err)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"auth_service/config"
+	"auth_service/genproto/user"
+	"auth_service/models"
+	"auth_service/pkg/authclient"
+	"auth_service/pkg/blob"
+	"auth_service/storage/postgres"
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxNameLength       = 100
+	maxPictureURLLength = 2048
+)
+
+// phoneNumberPattern matches E.164 numbers such as +998901234567.
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+type UserService struct {
+	user     *postgres.UserManagementImpl
+	profiles *postgres.UserProfileImpl
+	settings *postgres.UserSettingsImpl
+	blobs    blob.Storage
+	cnf      *config.Config
+	user.UnimplementedUserServiceServer
+}
+
+func NewUserService(user *postgres.UserManagementImpl, profiles *postgres.UserProfileImpl, settings *postgres.UserSettingsImpl, blobs blob.Storage, cnf *config.Config) *UserService {
+	return &UserService{
+		user:     user,
+		profiles: profiles,
+		settings: settings,
+		blobs:    blobs,
+		cnf:      cnf,
+	}
+}
+
+// GetUserProfile returns an empty profile for users who never saved one.
+func (u *UserService) GetUserProfile(ctx context.Context, req *user.GetUserProfileRequest) (*user.GetUserProfileResponse, error) {
+	userID, err := u.authorizeUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := u.profiles.GetByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := u.checkUserExists(ctx, userID); err != nil {
+			return nil, err
+		}
+		return &user.GetUserProfileResponse{UserId: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.GetUserProfileResponse{
+		UserId:         profile.UserID,
+		FirstName:      profile.FirstName,
+		LastName:       profile.LastName,
+		PhoneNumber:    profile.PhoneNumber,
+		ProfilePicture: profile.ProfilePicture,
+	}, nil
+}
+
+// UpdateUserProfile replaces the whole profile; fields left empty are cleared.
+func (u *UserService) UpdateUserProfile(ctx context.Context, req *user.UpdateUserProfileRequest) (*user.UpdateUserProfileResponse, error) {
+	userID, err := u.authorizeUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.UserProfile{
+		UserID:         userID,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		PhoneNumber:    req.PhoneNumber,
+		ProfilePicture: req.ProfilePicture,
+	}
+	if err := validateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	if err := u.checkUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := u.profiles.Upsert(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	return &user.UpdateUserProfileResponse{Message: "Profile updated successfully"}, nil
+}
+
+// authorizeUser returns the user a request is about. Users may only reach
+// their own data, admins anyone's. An empty id means the caller.
+func (u *UserService) authorizeUser(ctx context.Context, userID string) (string, error) {
+	claims, ok := authclient.ClaimsFromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "missing access token")
+	}
+
+	if userID == "" || userID == claims.UserID {
+		return claims.UserID, nil
+	}
+	if !claims.HasRole(models.RoleAdmin) {
+		return "", status.Error(codes.PermissionDenied, "not allowed to access another user")
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", status.Error(codes.InvalidArgument, "invalid user id")
+	}
+
+	return userID, nil
+}
+
+func (u *UserService) checkUserExists(ctx context.Context, userID string) error {
+	if _, err := u.user.GetByID(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status.Error(codes.NotFound, "user not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func validateProfile(profile *models.UserProfile) error {
+	badRequest := &errdetails.BadRequest{}
+	violation := func(field, description string) {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+
+	if utf8.RuneCountInString(profile.FirstName) > maxNameLength {
+		violation("first_name", "must be at most 100 characters")
+	}
+	if utf8.RuneCountInString(profile.LastName) > maxNameLength {
+		violation("last_name", "must be at most 100 characters")
+	}
+	if profile.PhoneNumber != "" && !phoneNumberPattern.MatchString(profile.PhoneNumber) {
+		violation("phone_number", "must be in E.164 format, e.g. +998901234567")
+	}
+	if profile.ProfilePicture != "" && !validPictureURL(profile.ProfilePicture) {
+		violation("profile_picture", "must be an http or https URL")
+	}
+
+	if len(badRequest.FieldViolations) == 0 {
+		return nil
+	}
+
+	return withDetails(status.New(codes.InvalidArgument, "invalid profile"), badRequest)
+}
+
+func validPictureURL(raw string) bool {
+	if len(raw) > maxPictureURLLength {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
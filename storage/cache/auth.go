@@ -22,6 +22,11 @@ func NewAuthCache(redis *redis.Client) *AuthCache {
 
 // CreateOrUpdateUserByEmail adds or updates a user in Redis by email.
 func (a *AuthCache) CreateOrUpdateUserByEmail(ctx context.Context, user *models.User) error {
+	// Users who signed up with a phone number have no email to key them by.
+	if user.Email == "" {
+		return nil
+	}
+
 	key := fmt.Sprintf("email:%s", user.Email)
 	data, err := json.Marshal(user)
 	if err != nil {
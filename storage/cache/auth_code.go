@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// AuthCodeCache keeps the authorization codes of the OpenID Connect provider
+// until the client exchanges them for tokens.
+type AuthCodeCache struct {
+	redis *redis.Client
+}
+
+func NewAuthCodeCache(client *redis.Client) *AuthCodeCache {
+	return &AuthCodeCache{redis: client}
+}
+
+// AuthCode is the authorization a code stands for.
+type AuthCode struct {
+	UserID        string   `json:"user_id"`
+	ClientID      string   `json:"client_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	Nonce         string   `json:"nonce,omitempty"`
+	CodeChallenge string   `json:"code_challenge"`
+	// AuthTime is when the user logged in, in Unix seconds.
+	AuthTime int64 `json:"auth_time"`
+}
+
+func (a *AuthCodeCache) SaveCode(ctx context.Context, code string, authCode *AuthCode, ttl time.Duration) error {
+	data, err := json.Marshal(authCode)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth code: %v", err)
+	}
+
+	if err := a.redis.Set(ctx, authCodeKey(code), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save auth code: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeCode returns the authorization of the code and deletes it, so that
+// each code is exchanged once. It returns nil if the code doesn't exist or
+// has expired.
+func (a *AuthCodeCache) ConsumeCode(ctx context.Context, code string) (*AuthCode, error) {
+	pipe := a.redis.TxPipeline()
+	get := pipe.Get(ctx, authCodeKey(code))
+	pipe.Del(ctx, authCodeKey(code))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to consume auth code: %v", err)
+	}
+	if get.Err() == redis.Nil {
+		return nil, nil
+	}
+
+	authCode := &AuthCode{}
+	if err := json.Unmarshal([]byte(get.Val()), authCode); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal auth code: %v", err)
+	}
+
+	return authCode, nil
+}
+
+func authCodeKey(code string) string { return fmt.Sprintf("auth_code:%s", code) }
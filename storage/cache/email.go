@@ -36,3 +36,58 @@ func (e *EmailCache) GetEmailByLink(link string) (string, error) {
 
 	return email, nil
 }
+
+// SaveMagicLink stores the ID of a login link token until it is used or
+// expires. Only the ID is stored; the token itself is signed.
+func (e *EmailCache) SaveMagicLink(ctx context.Context, jti, userID string, ttl time.Duration) error {
+	err := e.redis.Set(ctx, magicLinkKey(jti), userID, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save magic link: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink removes the login link and returns the user it was sent
+// to, or "" if it was used already or expired.
+func (e *EmailCache) ConsumeMagicLink(ctx context.Context, jti string) (string, error) {
+	pipe := e.redis.TxPipeline()
+	get := pipe.Get(ctx, magicLinkKey(jti))
+	pipe.Del(ctx, magicLinkKey(jti))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", fmt.Errorf("failed to consume magic link: %v", err)
+	}
+	if get.Err() == redis.Nil {
+		return "", nil
+	}
+
+	return get.Val(), nil
+}
+
+// ReserveMagicLink reports whether a link may be requested for the subject
+// now, and if so blocks further ones for interval. Subjects are built with
+// EmailSubject and IPSubject.
+func (e *EmailCache) ReserveMagicLink(ctx context.Context, subject string, interval time.Duration) (bool, error) {
+	ok, err := e.redis.SetNX(ctx, fmt.Sprintf("magic_link_cooldown:%s", subject), 1, interval).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check magic link cooldown: %v", err)
+	}
+
+	return ok, nil
+}
+
+// ReservePasswordReset reports whether a reset may be requested for the
+// subject now, and if so blocks further ones for interval. Subjects are built
+// with EmailSubject and IPSubject.
+func (e *EmailCache) ReservePasswordReset(ctx context.Context, subject string, interval time.Duration) (bool, error) {
+	ok, err := e.redis.SetNX(ctx, fmt.Sprintf("password_reset_cooldown:%s", subject), 1, interval).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check password reset cooldown: %v", err)
+	}
+
+	return ok, nil
+}
+
+// Magic link keys have prefixes of their own: keys under "link:" are named
+// after verification links, which come from clients.
+func magicLinkKey(jti string) string { return fmt.Sprintf("magic_link:%s", jti) }
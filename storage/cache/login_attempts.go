@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"auth_service/config"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockHistoryTTL is how long the number of past locks is remembered, so that
+// repeated lockouts keep growing instead of starting over every time.
+const lockHistoryTTL = 24 * time.Hour
+
+type LoginAttemptCache struct {
+	redis *redis.Client
+	cnf   config.LockoutConfig
+}
+
+func NewLoginAttemptCache(client *redis.Client, cnf config.LockoutConfig) *LoginAttemptCache {
+	return &LoginAttemptCache{
+		redis: client,
+		cnf:   cnf,
+	}
+}
+
+// EmailSubject, UserSubject and IPSubject build the subjects failed attempts
+// are counted for. Emails ignore case and surrounding spaces, so that they
+// can't be varied to get a fresh counter.
+func EmailSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPSubject(ip string) string { return "ip:" + ip }
+
+// UserSubject is for users without email, who log in by phone.
+func UserSubject(userID string) string { return "user:" + userID }
+
+// LockedFor returns how long the subject stays locked, or zero if it is not locked.
+func (l *LoginAttemptCache) LockedFor(ctx context.Context, subject string) (time.Duration, error) {
+	ttl, err := l.redis.PTTL(ctx, lockKey(subject)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lock: %v", err)
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// RegisterAttempt counts a login attempt for the subject before its
+// credentials are checked, so that concurrent guesses can't get past
+// maxAttempts. It returns how many attempts are left after this one, or how
+// long the subject is locked, in which case the credentials mustn't be
+// checked. Attempts beyond maxAttempts lock the subject at once; Lock does
+// so after the last allowed one fails.
+func (l *LoginAttemptCache) RegisterAttempt(ctx context.Context, subject string, maxAttempts int) (int, time.Duration, error) {
+	lockedFor, err := l.LockedFor(ctx, subject)
+	if err != nil || lockedFor > 0 {
+		return 0, lockedFor, err
+	}
+
+	key := attemptsKey(subject)
+
+	pipe := l.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, l.cnf.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to count login attempt: %v", err)
+	}
+
+	if incr.Val() > int64(maxAttempts) {
+		lockedFor, err := l.Lock(ctx, subject)
+		return 0, lockedFor, err
+	}
+
+	return maxAttempts - int(incr.Val()), 0, nil
+}
+
+// ReleaseAttempt takes back an attempt that turned out to be right but
+// doesn't complete a login yet, such as a password before the second factor.
+func (l *LoginAttemptCache) ReleaseAttempt(ctx context.Context, subject string) error {
+	key := attemptsKey(subject)
+
+	left, err := l.redis.Decr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to release login attempt: %v", err)
+	}
+	// The counter was reset or the subject locked meanwhile.
+	if left <= 0 {
+		if err := l.redis.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("failed to release login attempt: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Lock locks the subject and returns the lock period, unless it is locked
+// already. Every lock within lockHistoryTTL of the previous one lasts twice
+// as long.
+func (l *LoginAttemptCache) Lock(ctx context.Context, subject string) (time.Duration, error) {
+	lockedFor, err := l.LockedFor(ctx, subject)
+	if err != nil || lockedFor > 0 {
+		return lockedFor, err
+	}
+
+	locks, err := l.redis.Incr(ctx, lockCountKey(subject)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count login locks: %v", err)
+	}
+
+	duration := l.cnf.BaseDuration
+	for i := int64(1); i < locks && duration < l.cnf.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > l.cnf.MaxDuration {
+		duration = l.cnf.MaxDuration
+	}
+
+	pipe := l.redis.TxPipeline()
+	pipe.Expire(ctx, lockCountKey(subject), lockHistoryTTL)
+	pipe.Set(ctx, lockKey(subject), locks, duration)
+	pipe.Del(ctx, attemptsKey(subject))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to lock login: %v", err)
+	}
+
+	return duration, nil
+}
+
+// Reset forgets failed attempts and past locks of the subject after a successful login.
+func (l *LoginAttemptCache) Reset(ctx context.Context, subject string) error {
+	err := l.redis.Del(ctx, attemptsKey(subject), lockCountKey(subject)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to reset login attempts: %v", err)
+	}
+
+	return nil
+}
+
+func attemptsKey(subject string) string  { return fmt.Sprintf("login_attempts:%s", subject) }
+func lockKey(subject string) string      { return fmt.Sprintf("login_lock:%s", subject) }
+func lockCountKey(subject string) string { return fmt.Sprintf("login_lock_count:%s", subject) }
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MfaCache keeps the short-lived challenges handed out by Login to users with
+// two-factor authentication, until they are exchanged in VerifyMfa.
+type MfaCache struct {
+	redis *redis.Client
+}
+
+func NewMfaCache(client *redis.Client) *MfaCache {
+	return &MfaCache{redis: client}
+}
+
+// MfaChallenge is the login waiting for its second factor.
+type MfaChallenge struct {
+	UserID   string   `json:"user_id"`
+	ClientID string   `json:"client_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+func (m *MfaCache) SaveChallenge(ctx context.Context, token string, challenge *MfaChallenge, ttl time.Duration) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mfa challenge: %v", err)
+	}
+
+	err = m.redis.Set(ctx, challengeKey(token), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save mfa challenge: %v", err)
+	}
+
+	return nil
+}
+
+// GetChallenge returns the login the challenge was issued for, or nil if it
+// doesn't exist or has expired.
+func (m *MfaCache) GetChallenge(ctx context.Context, token string) (*MfaChallenge, error) {
+	data, err := m.redis.Get(ctx, challengeKey(token)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %v", err)
+	}
+
+	challenge := &MfaChallenge{}
+	if err := json.Unmarshal(data, challenge); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal mfa challenge: %v", err)
+	}
+
+	return challenge, nil
+}
+
+// RegisterAttempt counts an attempt at the challenge, before its code is
+// checked, and returns the number of attempts so far.
+func (m *MfaCache) RegisterAttempt(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	key := challengeAttemptsKey(token)
+
+	pipe := m.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count mfa attempt: %v", err)
+	}
+
+	return incr.Val(), nil
+}
+
+func (m *MfaCache) DeleteChallenge(ctx context.Context, token string) error {
+	err := m.redis.Del(ctx, challengeKey(token), challengeAttemptsKey(token)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete mfa challenge: %v", err)
+	}
+
+	return nil
+}
+
+func challengeKey(token string) string { return fmt.Sprintf("mfa_challenge:%s", token) }
+func challengeAttemptsKey(token string) string {
+	return fmt.Sprintf("mfa_challenge_attempts:%s", token)
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"auth_service/config"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sendWindow is the period PhoneLoginConfig.MaxSendsPerHour counts sends in.
+const sendWindow = time.Hour
+
+// PhoneCodeCache keeps the codes texted by StartPhoneLogin until they are
+// entered in CompletePhoneLogin, and limits how often they are sent.
+type PhoneCodeCache struct {
+	redis *redis.Client
+	cnf   config.PhoneLoginConfig
+}
+
+func NewPhoneCodeCache(client *redis.Client, cnf config.PhoneLoginConfig) *PhoneCodeCache {
+	return &PhoneCodeCache{
+		redis: client,
+		cnf:   cnf,
+	}
+}
+
+// ReserveSend records a send to the number from the client IP if the limits
+// allow one, and otherwise returns how long to wait. ip may be empty.
+func (p *PhoneCodeCache) ReserveSend(ctx context.Context, phone, ip string) (time.Duration, error) {
+	if ip != "" {
+		retryAfter, err := p.countSend(ctx, phoneIPSendsKey(ip), p.cnf.MaxSendsPerHourPerIP)
+		if err != nil || retryAfter > 0 {
+			return retryAfter, err
+		}
+	}
+
+	ok, err := p.redis.SetNX(ctx, phoneCooldownKey(phone), 1, p.cnf.ResendInterval).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check phone code cooldown: %v", err)
+	}
+	if !ok {
+		return p.ttl(ctx, phoneCooldownKey(phone))
+	}
+
+	return p.countSend(ctx, phoneSendsKey(phone), p.cnf.MaxSendsPerHour)
+}
+
+// countSend counts a send under key and returns how long to wait if that
+// makes more than max in the window.
+func (p *PhoneCodeCache) countSend(ctx context.Context, key string, max int) (time.Duration, error) {
+	sends, err := p.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count phone code send: %v", err)
+	}
+	if sends == 1 {
+		if err := p.redis.Expire(ctx, key, sendWindow).Err(); err != nil {
+			return 0, fmt.Errorf("failed to count phone code send: %v", err)
+		}
+	}
+	if sends > int64(max) {
+		return p.ttl(ctx, key)
+	}
+
+	return 0, nil
+}
+
+// SaveCode stores the hash of a new code, replacing the previous one and its
+// failed attempts.
+func (p *PhoneCodeCache) SaveCode(ctx context.Context, phone, codeHash string) error {
+	pipe := p.redis.TxPipeline()
+	pipe.Set(ctx, phoneCodeKey(phone), codeHash, p.cnf.CodeTTL)
+	pipe.Del(ctx, phoneAttemptsKey(phone))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save phone code: %v", err)
+	}
+
+	return nil
+}
+
+// GetCode returns the hash of the code sent to the number, or "" if there is
+// none or it expired.
+func (p *PhoneCodeCache) GetCode(ctx context.Context, phone string) (string, error) {
+	hash, err := p.redis.Get(ctx, phoneCodeKey(phone)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get phone code: %v", err)
+	}
+
+	return hash, nil
+}
+
+// RegisterAttempt counts an attempt at the code before it is checked, and
+// returns the number of attempts so far. Counting first means parallel
+// guesses can't all get in before the limit is reached.
+func (p *PhoneCodeCache) RegisterAttempt(ctx context.Context, phone string) (int64, error) {
+	key := phoneAttemptsKey(phone)
+
+	pipe := p.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, p.cnf.CodeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count phone code attempt: %v", err)
+	}
+
+	return incr.Val(), nil
+}
+
+// DeleteCode removes the code and reports whether it was still there, so that
+// of two requests with the right code only one gets through.
+func (p *PhoneCodeCache) DeleteCode(ctx context.Context, phone string) (bool, error) {
+	pipe := p.redis.TxPipeline()
+	deleted := pipe.Del(ctx, phoneCodeKey(phone))
+	pipe.Del(ctx, phoneAttemptsKey(phone))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to delete phone code: %v", err)
+	}
+
+	return deleted.Val() > 0, nil
+}
+
+func (p *PhoneCodeCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := p.redis.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check phone code limit: %v", err)
+	}
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+
+	return ttl, nil
+}
+
+func phoneCodeKey(phone string) string     { return "phone_code:" + phone }
+func phoneAttemptsKey(phone string) string { return "phone_code_attempts:" + phone }
+func phoneCooldownKey(phone string) string { return "phone_code_cooldown:" + phone }
+func phoneSendsKey(phone string) string    { return "phone_code_sends:" + phone }
+func phoneIPSendsKey(ip string) string     { return "phone_code_sends:ip:" + ip }
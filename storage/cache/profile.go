@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"auth_service/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type ProfileCache struct {
+	redis *redis.Client
+}
+
+func NewProfileCache(redis *redis.Client) *ProfileCache {
+	return &ProfileCache{redis: redis}
+}
+
+// SetProfile adds or updates a user profile in Redis.
+func (p *ProfileCache) SetProfile(ctx context.Context, profile *models.UserProfile) error {
+	key := fmt.Sprintf("profile:%s", profile.UserID)
+	data, err := json.Marshal(profile)
+	if err != nil {
+		log.Println("Failed to marshal profile: ", err)
+		return err
+	}
+
+	_, err = p.redis.Set(ctx, key, data, 24*time.Hour).Result()
+	if err != nil {
+		log.Println("Failed to set profile in Redis: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetProfile retrieves a user profile from Redis. It returns nil if the
+// profile isn't cached.
+func (p *ProfileCache) GetProfile(ctx context.Context, userID string) (*models.UserProfile, error) {
+	key := fmt.Sprintf("profile:%s", userID)
+	cmd := p.redis.Get(ctx, key)
+	if err := cmd.Err(); err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		log.Println("Redis connection error: ", err)
+		return nil, err
+	}
+
+	profile := models.UserProfile{}
+	data, err := cmd.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.NewDecoder(bytes.NewBuffer(data)).Decode(&profile); err != nil {
+		log.Println("Failed decoding data: ", err)
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// DeleteProfile removes a user profile from Redis.
+func (p *ProfileCache) DeleteProfile(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("profile:%s", userID)
+	_, err := p.redis.Del(ctx, key).Result()
+	if err != nil {
+		log.Println("Failed to delete profile from Redis: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"auth_service/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type SettingsCache struct {
+	redis *redis.Client
+}
+
+func NewSettingsCache(redis *redis.Client) *SettingsCache {
+	return &SettingsCache{redis: redis}
+}
+
+// SetSettings adds or updates the settings of a user in Redis.
+func (s *SettingsCache) SetSettings(ctx context.Context, settings *models.UserSettings) error {
+	key := fmt.Sprintf("settings:%s", settings.UserID)
+	data, err := json.Marshal(settings)
+	if err != nil {
+		log.Println("Failed to marshal settings: ", err)
+		return err
+	}
+
+	_, err = s.redis.Set(ctx, key, data, 24*time.Hour).Result()
+	if err != nil {
+		log.Println("Failed to set settings in Redis: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSettings retrieves the settings of a user from Redis. It returns nil if
+// they aren't cached.
+func (s *SettingsCache) GetSettings(ctx context.Context, userID string) (*models.UserSettings, error) {
+	key := fmt.Sprintf("settings:%s", userID)
+	cmd := s.redis.Get(ctx, key)
+	if err := cmd.Err(); err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		log.Println("Redis connection error: ", err)
+		return nil, err
+	}
+
+	settings := models.UserSettings{}
+	data, err := cmd.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.NewDecoder(bytes.NewBuffer(data)).Decode(&settings); err != nil {
+		log.Println("Failed decoding data: ", err)
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// DeleteSettings removes the settings of a user from Redis.
+func (s *SettingsCache) DeleteSettings(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("settings:%s", userID)
+	_, err := s.redis.Del(ctx, key).Result()
+	if err != nil {
+		log.Println("Failed to delete settings from Redis: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -1,14 +1,11 @@
 package cache
 
 import (
-	"auth_service/config"
-	"auth_service/models"
 	"context"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/golang-jwt/jwt"
 )
 
 type TokenCache struct {
@@ -27,18 +24,14 @@ type RevokeTokens struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func (t *TokenCache) RevokeToken(ctx context.Context, tokens *RevokeTokens) error {
+// RevokeToken keeps the tokens revoked until expiresAt, after which they are
+// rejected anyway.
+func (t *TokenCache) RevokeToken(ctx context.Context, tokens *RevokeTokens, expiresAt time.Time) error {
 	key := fmt.Sprintf("revoked_token:refresh_token:%s:access_token:%s", tokens.RefreshToken, tokens.AccessToken)
 
-	claims, err := ExtractClaims(tokens.RefreshToken)
-	if err != nil {
-		return fmt.Errorf("failed to extract claims: %v", err)
-	}
-
-	expirationTime := time.Unix(claims.ExpiresAt.Unix(), 0)
-	timeLeft := expirationTime.Sub(time.Now())
+	timeLeft := time.Until(expiresAt)
 	if timeLeft > 0 {
-		err = t.redis.Set(ctx, key, "revoked", timeLeft).Err()
+		err := t.redis.Set(ctx, key, "revoked", timeLeft).Err()
 		if err != nil {
 			return fmt.Errorf("failed to revoke token: %v", err)
 		}
@@ -57,20 +50,132 @@ func (t *TokenCache) IsRevokedToken(ctx context.Context, refreshToken string, ac
 
 	return result == 1, nil
 }
-func ExtractClaims(tokenStr string) (*models.Claims, error) {
-	claims := &models.Claims{} // Initialize the claims object
-	cnf := config.NewConfig()
-	cnf.Load()
 
-	jwtKey := cnf.JWT.SecretKey
+// SetTokenGeneration caches the current token generation of the user.
+func (t *TokenCache) SetTokenGeneration(ctx context.Context, userID string, generation int64) error {
+	key := fmt.Sprintf("token_generation:%s", userID)
+
+	if err := t.redis.Set(ctx, key, generation, 24*time.Hour).Err(); err != nil {
+		return fmt.Errorf("failed to cache token generation: %v", err)
+	}
+
+	return nil
+}
+
+// GetTokenGeneration returns the cached token generation of the user and
+// whether it was cached at all.
+func (t *TokenCache) GetTokenGeneration(ctx context.Context, userID string) (int64, bool, error) {
+	key := fmt.Sprintf("token_generation:%s", userID)
+
+	generation, err := t.redis.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get token generation: %v", err)
+	}
+
+	return generation, true, nil
+}
+
+// RevokeSession makes the access tokens of a login unusable. The marker only
+// has to outlive them, which is ttl.
+func (t *TokenCache) RevokeSession(ctx context.Context, familyID, reason string, ttl time.Duration) error {
+	key := fmt.Sprintf("revoked_session:%s", familyID)
+
+	if err := t.redis.Set(ctx, key, reason, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+
+	return nil
+}
 
-	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(jwtKey), nil
-	})
+// RevokedSessionReason returns why the login was revoked, or an empty string
+// if it wasn't.
+func (t *TokenCache) RevokedSessionReason(ctx context.Context, familyID string) (string, error) {
+	key := fmt.Sprintf("revoked_session:%s", familyID)
 
+	reason, err := t.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract claims: %v", err)
+		return "", fmt.Errorf("failed to check revoked session: %v", err)
 	}
 
-	return claims, nil
+	return reason, nil
 }
+
+// TokenStatusActive is cached for refresh tokens that can still be used;
+// revoked ones are cached as their revoke reason.
+const TokenStatusActive = "active"
+
+// SetTokenStatus caches the state of a stored refresh token. Postgres stays
+// the source of truth, the cache only saves a query per refresh.
+func (t *TokenCache) SetTokenStatus(ctx context.Context, jti, status string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("token_status:%s", jti)
+	if err := t.redis.Set(ctx, key, status, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache token status: %v", err)
+	}
+
+	return nil
+}
+
+// GetTokenStatus returns the cached state of a refresh token, or an empty
+// string if it isn't cached.
+func (t *TokenCache) GetTokenStatus(ctx context.Context, jti string) (string, error) {
+	key := fmt.Sprintf("token_status:%s", jti)
+
+	status, err := t.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get token status: %v", err)
+	}
+
+	return status, nil
+}
+
+// MarkIdTokenUsed records that an external ID token was used to log in. It
+// reports false if it was already used, so a leaked token can't be replayed.
+func (t *TokenCache) MarkIdTokenUsed(ctx context.Context, hash string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	key := fmt.Sprintf("id_token_used:%s", hash)
+	ok, err := t.redis.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark id token used: %v", err)
+	}
+
+	return ok, nil
+}
+
+// SaveIdTokenNonce stores a nonce handed out for a login with an external ID
+// token until it is used or expires.
+func (t *TokenCache) SaveIdTokenNonce(ctx context.Context, nonce string, ttl time.Duration) error {
+	if err := t.redis.Set(ctx, idTokenNonceKey(nonce), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save id token nonce: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeIdTokenNonce removes the nonce and reports whether it was there, so
+// that each nonce is good for one login.
+func (t *TokenCache) ConsumeIdTokenNonce(ctx context.Context, nonce string) (bool, error) {
+	n, err := t.redis.Del(ctx, idTokenNonceKey(nonce)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume id token nonce: %v", err)
+	}
+
+	return n > 0, nil
+}
+
+func idTokenNonceKey(nonce string) string { return "id_token_nonce:" + nonce }
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+type ConsentImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewConsentSQL(db *sql.DB) *ConsentImpl {
+	return &ConsentImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// GetScopes returns the scopes the user consented to for the client, or
+// sql.ErrNoRows if they never did.
+func (c *ConsentImpl) GetScopes(ctx context.Context, userID, clientID string) ([]string, error) {
+	sqlQuery, args, err := c.sqlBuilder.Select("scopes").
+		From("oauth_consents").
+		Where(sq.Eq{"user_id": userID, "client_id": clientID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var scopes pq.StringArray
+	err = c.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&scopes)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		log.Println("Failed to get consent: ", err)
+		return nil, err
+	}
+
+	return scopes, nil
+}
+
+// Grant adds the scopes to those the user consented to for the client.
+func (c *ConsentImpl) Grant(ctx context.Context, userID, clientID string, scopes []string) error {
+	sqlQuery, args, err := c.sqlBuilder.Insert("oauth_consents").
+		Columns("user_id", "client_id", "scopes").
+		Values(userID, clientID, pq.StringArray(scopes)).
+		Suffix(`ON CONFLICT (user_id, client_id) DO UPDATE SET
+			scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)),
+			updated_at = CURRENT_TIMESTAMP`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if _, err := c.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		log.Println("Failed to save consent: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// Revoke deletes the consent. It reports false if there was none.
+func (c *ConsentImpl) Revoke(ctx context.Context, userID, clientID string) (bool, error) {
+	sqlQuery, args, err := c.sqlBuilder.Delete("oauth_consents").
+		Where(sq.Eq{"user_id": userID, "client_id": clientID}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := c.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to revoke consent: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
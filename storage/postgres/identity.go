@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type IdentityImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewIdentitySQL(db *sql.DB) *IdentityImpl {
+	return &IdentityImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// GetUserID returns the user linked to the provider account, or
+// sql.ErrNoRows.
+func (i *IdentityImpl) GetUserID(ctx context.Context, provider, subject string) (string, error) {
+	sqlQuery, args, err := i.sqlBuilder.Select("user_id").
+		From("user_identities").
+		Where(sq.Eq{"provider": provider, "subject": subject}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var userID string
+	err = i.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", sql.ErrNoRows
+	}
+	if err != nil {
+		log.Println("Failed to get identity: ", err)
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// Link links the provider account to the user. If it was linked meanwhile,
+// the user it is linked to is returned instead.
+func (i *IdentityImpl) Link(ctx context.Context, provider, subject, userID, email string) (string, error) {
+	sqlQuery, args, err := i.sqlBuilder.Insert("user_identities").
+		Columns("provider", "subject", "user_id", "email").
+		Values(provider, subject, userID, sq.Expr("NULLIF(?, '')", email)).
+		Suffix("ON CONFLICT (provider, subject) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if _, err := i.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		log.Println("Failed to link identity: ", err)
+		return "", err
+	}
+
+	return i.GetUserID(ctx, provider, subject)
+}
+
+// CreateUser creates a user without password for a provider account seen for
+// the first time, and links the account to it in the same transaction. If
+// the account was linked meanwhile, no user is created and the linked user
+// is returned with created set to false. The user only gets the email if the
+// provider verified it.
+func (i *IdentityImpl) CreateUser(ctx context.Context, provider, subject, email string, emailVerified bool) (userID string, created bool, err error) {
+	userEmail := ""
+	if emailVerified {
+		userEmail = email
+	}
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+
+	sqlQuery, args, err := i.sqlBuilder.Insert("users").
+		Columns("email", "hashed_password", "name", "is_verified").
+		Values(sq.Expr("NULLIF(?, '')", userEmail), "", "user", emailVerified).
+		Suffix("RETURNING user_id").
+		ToSql()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if err := tx.QueryRowContext(ctx, sqlQuery, args...).Scan(&userID); err != nil {
+		log.Println("Failed to insert user: ", err)
+		return "", false, err
+	}
+
+	sqlQuery, args, err = i.sqlBuilder.Insert("user_identities").
+		Columns("provider", "subject", "user_id", "email").
+		Values(provider, subject, userID, sq.Expr("NULLIF(?, '')", email)).
+		Suffix("ON CONFLICT (provider, subject) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to link identity: ", err)
+		return "", false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", false, err
+	}
+	if n == 0 {
+		// A concurrent first login won; drop the user made for this one.
+		tx.Rollback()
+		userID, err = i.GetUserID(ctx, provider, subject)
+		return userID, false, err
+	}
+
+	return userID, true, tx.Commit()
+}
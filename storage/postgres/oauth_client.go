@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+type OAuthClientImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewOAuthClientSQL(db *sql.DB) *OAuthClientImpl {
+	return &OAuthClientImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// GetByID returns the client, or sql.ErrNoRows if it isn't registered.
+func (o *OAuthClientImpl) GetByID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	sqlQuery, args, err := o.sqlBuilder.Select(
+		"client_id",
+		"name",
+		"allowed_scopes",
+		"secret_hash",
+		"redirect_uris",
+		"first_party",
+		"created_at",
+	).From("oauth_clients").
+		Where(sq.Eq{"client_id": clientID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	client := &models.OAuthClient{}
+	err = o.db.QueryRowContext(ctx, sqlQuery, args...).Scan(
+		&client.ClientID,
+		&client.Name,
+		(*pq.StringArray)(&client.AllowedScopes),
+		&client.SecretHash,
+		(*pq.StringArray)(&client.RedirectURIs),
+		&client.FirstParty,
+		&client.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		log.Println("Failed to get oauth client: ", err)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Create registers a client. It reports false if the client ID is taken.
+func (o *OAuthClientImpl) Create(ctx context.Context, client *models.OAuthClient) (bool, error) {
+	sqlQuery, args, err := o.sqlBuilder.Insert("oauth_clients").
+		Columns("client_id", "name", "allowed_scopes", "secret_hash", "redirect_uris", "first_party").
+		Values(
+			client.ClientID,
+			client.Name,
+			pq.StringArray(client.AllowedScopes),
+			client.SecretHash,
+			pq.StringArray(client.RedirectURIs),
+			client.FirstParty,
+		).
+		Suffix("ON CONFLICT (client_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := o.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to create oauth client: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type PasswordResetImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewPasswordResetSQL(db *sql.DB) *PasswordResetImpl {
+	return &PasswordResetImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (p *PasswordResetImpl) Create(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	sqlQuery, args, err := p.sqlBuilder.Insert("password_resets").
+		Columns("user_id", "reset_token", "expires_at").
+		Values(userID, tokenHash, expiresAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert password reset: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// Consume marks an unused, unexpired reset as used and returns its user.
+// It returns sql.ErrNoRows if there is no such reset.
+func (p *PasswordResetImpl) Consume(ctx context.Context, tokenHash string) (string, error) {
+	sqlQuery, args, err := p.sqlBuilder.Update("password_resets").
+		Set("used_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Where(sq.Eq{"reset_token": tokenHash, "used_at": nil}).
+		Where("expires_at > CURRENT_TIMESTAMP").
+		Suffix("RETURNING user_id").
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var userID string
+	err = p.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", sql.ErrNoRows
+		}
+		log.Println("Failed to consume password reset: ", err)
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// InvalidateForUser uses up every outstanding reset of the user.
+func (p *PasswordResetImpl) InvalidateForUser(ctx context.Context, userID string) error {
+	sqlQuery, args, err := p.sqlBuilder.Update("password_resets").
+		Set("used_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Where(sq.Eq{"user_id": userID, "used_at": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to invalidate password resets: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type RecoveryCodeImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewRecoveryCodeSQL(db *sql.DB) *RecoveryCodeImpl {
+	return &RecoveryCodeImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// ReplaceCodes deletes all codes of the user, used or not, and stores the new hashes.
+func (r *RecoveryCodeImpl) ReplaceCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery, args, err := r.sqlBuilder.Delete("recovery_codes").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		log.Println("Failed to delete recovery codes: ", err)
+		return err
+	}
+
+	insert := r.sqlBuilder.Insert("recovery_codes").Columns("user_id", "code_hash")
+	for _, hash := range codeHashes {
+		insert = insert.Values(userID, hash)
+	}
+
+	sqlQuery, args, err = insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		log.Println("Failed to insert recovery codes: ", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Use uses up the unused code of the user with the given hash. It reports
+// false if there is none, e.g. because a concurrent login used it first.
+func (r *RecoveryCodeImpl) Use(ctx context.Context, userID, codeHash string) (bool, error) {
+	sqlQuery, args, err := r.sqlBuilder.Update("recovery_codes").
+		Set("used_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Where(sq.Eq{"user_id": userID, "code_hash": codeHash, "used_at": nil}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to mark recovery code used: ", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *RecoveryCodeImpl) CountUnused(ctx context.Context, userID string) (int, error) {
+	sqlQuery, args, err := r.sqlBuilder.Select("COUNT(*)").
+		From("recovery_codes").
+		Where(sq.Eq{"user_id": userID, "used_at": nil}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&count); err != nil {
+		log.Println("Failed to count recovery codes: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *RecoveryCodeImpl) DeleteByUserID(ctx context.Context, userID string) error {
+	sqlQuery, args, err := r.sqlBuilder.Delete("recovery_codes").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to delete recovery codes: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type RoleImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewRoleSQL(db *sql.DB) *RoleImpl {
+	return &RoleImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// Exists reports whether the role is defined in the roles table.
+func (r *RoleImpl) Exists(ctx context.Context, role string) (bool, error) {
+	sqlQuery, args, err := r.sqlBuilder.Select("1").
+		From("roles").
+		Where(sq.Eq{"role": role}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var one int
+	err = r.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.Println("Failed to check role: ", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *RoleImpl) ListForUser(ctx context.Context, userID string) ([]string, error) {
+	sqlQuery, args, err := r.sqlBuilder.Select("role").
+		From("user_roles").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("role").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to get user roles: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			log.Println("Failed to scan user role: ", err)
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// Grant gives the user a role. grantedBy is empty for roles given by the
+// service itself. It reports false if the user already had the role.
+func (r *RoleImpl) Grant(ctx context.Context, userID, role, grantedBy string) (bool, error) {
+	var by interface{}
+	if grantedBy != "" {
+		by = grantedBy
+	}
+
+	sqlQuery, args, err := r.sqlBuilder.Insert("user_roles").
+		Columns("user_id", "role", "granted_by").
+		Values(userID, role, by).
+		Suffix("ON CONFLICT (user_id, role) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	return r.exec(ctx, sqlQuery, args, "Failed to grant role: ")
+}
+
+// Revoke takes a role away from the user. It reports false if the user
+// didn't have it.
+func (r *RoleImpl) Revoke(ctx context.Context, userID, role string) (bool, error) {
+	sqlQuery, args, err := r.sqlBuilder.Delete("user_roles").
+		Where(sq.Eq{"user_id": userID, "role": role}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	return r.exec(ctx, sqlQuery, args, "Failed to revoke role: ")
+}
+
+func (r *RoleImpl) exec(ctx context.Context, sqlQuery string, args []interface{}, failure string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println(failure, err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+type ScopeImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewScopeSQL(db *sql.DB) *ScopeImpl {
+	return &ScopeImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// AllowedForUser returns the scopes of all roles of the user.
+func (s *ScopeImpl) AllowedForUser(ctx context.Context, userID string) ([]string, error) {
+	sqlQuery, args, err := s.sqlBuilder.Select("DISTINCT rs.scope").
+		From("role_scopes rs").
+		Join("user_roles ur ON ur.role = rs.role").
+		Where(sq.Eq{"ur.user_id": userID}).
+		OrderBy("rs.scope").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to get user scopes: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []string
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			log.Println("Failed to scan scope: ", err)
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, rows.Err()
+}
+
+// AllowedForClient returns the scopes the client may be granted. It returns
+// sql.ErrNoRows if the client isn't registered.
+func (s *ScopeImpl) AllowedForClient(ctx context.Context, clientID string) ([]string, error) {
+	sqlQuery, args, err := s.sqlBuilder.Select("allowed_scopes").
+		From("oauth_clients").
+		Where(sq.Eq{"client_id": clientID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var scopes pq.StringArray
+	err = s.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&scopes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		log.Println("Failed to get client scopes: ", err)
+		return nil, err
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type SecurityEventImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewSecurityEventSQL(db *sql.DB) *SecurityEventImpl {
+	return &SecurityEventImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (s *SecurityEventImpl) Create(ctx context.Context, event *models.SecurityEvent) error {
+	sqlQuery, args, err := s.sqlBuilder.Insert("security_events").
+		Columns("user_id", "event_type", "ip_address", "details").
+		Values(event.UserID, event.EventType, event.IPAddress, event.Details).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert security event: ", err)
+		return err
+	}
+
+	return nil
+}
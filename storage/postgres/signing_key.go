@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type SigningKeyImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewSigningKeySQL(db *sql.DB) *SigningKeyImpl {
+	return &SigningKeyImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (s *SigningKeyImpl) Create(ctx context.Context, key *models.SigningKey) error {
+	sqlQuery, args, err := s.sqlBuilder.Insert("signing_keys").
+		Columns("kid", "algorithm", "public_key", "activates_at").
+		Values(key.KID, key.Algorithm, key.PublicKey, key.ActivatesAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert signing key: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListUsable returns the keys that aren't retired yet, oldest first.
+func (s *SigningKeyImpl) ListUsable(ctx context.Context) ([]*models.SigningKey, error) {
+	sqlQuery, args, err := s.sqlBuilder.Select(
+		"kid",
+		"algorithm",
+		"public_key",
+		"created_at",
+		"activates_at",
+		"retire_at",
+	).From("signing_keys").
+		Where("retire_at IS NULL OR retire_at > CURRENT_TIMESTAMP").
+		OrderBy("activates_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to get signing keys: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.SigningKey
+	for rows.Next() {
+		key := &models.SigningKey{}
+		err := rows.Scan(
+			&key.KID,
+			&key.Algorithm,
+			&key.PublicKey,
+			&key.CreatedAt,
+			&key.ActivatesAt,
+			&key.RetireAt,
+		)
+		if err != nil {
+			log.Println("Failed to scan signing key: ", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Retire schedules the retirement of a key. A retirement that is already
+// scheduled is only ever brought forward. It returns sql.ErrNoRows if the key
+// doesn't exist or is retired already.
+func (s *SigningKeyImpl) Retire(ctx context.Context, kid string, at time.Time) error {
+	sqlQuery, args, err := s.sqlBuilder.Update("signing_keys").
+		Set("retire_at", sq.Expr("LEAST(COALESCE(retire_at, ?), ?)", at, at)).
+		Where(sq.Eq{"kid": kid}).
+		Where("retire_at IS NULL OR retire_at > CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to retire signing key: ", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -1 +1,329 @@
 package postgres
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Results of TokenImpl.Rotate.
+const (
+	RotationOK = iota
+	// RotationRevoked means the token is unknown, expired or revoked.
+	RotationRevoked
+	// RotationReused means the token was already rotated once.
+	RotationReused
+)
+
+type TokenImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewTokenSQL(db *sql.DB) *TokenImpl {
+	return &TokenImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (t *TokenImpl) Create(ctx context.Context, token *models.Token) error {
+	return t.insert(ctx, t.db, token)
+}
+
+func (t *TokenImpl) GetByJTI(ctx context.Context, jti string) (*models.Token, error) {
+	sqlQuery, args, err := t.selectTokens().Where(sq.Eq{"jti": jti}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	token, err := scanToken(t.db.QueryRowContext(ctx, sqlQuery, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		log.Println("Failed to scan token: ", err)
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Rotate revokes the token with the given jti and stores next in its place,
+// keeping the device, client and scope of the old token. The old row is locked, so only one of
+// two concurrent rotations of the same token can succeed.
+func (t *TokenImpl) Rotate(ctx context.Context, jti string, next *models.Token) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sqlQuery, args, err := t.selectTokens().Where(sq.Eq{"jti": jti}).Suffix("FOR UPDATE").ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	current, err := scanToken(tx.QueryRowContext(ctx, sqlQuery, args...))
+	if err == sql.ErrNoRows {
+		return RotationRevoked, nil
+	}
+	if err != nil {
+		log.Println("Failed to scan token: ", err)
+		return 0, err
+	}
+
+	if current.ReplacedBy != "" {
+		return RotationReused, nil
+	}
+	if current.IsRevoked || !current.ExpiresAt.After(next.CreatedAt) {
+		return RotationRevoked, nil
+	}
+
+	sqlQuery, args, err = t.sqlBuilder.Update("tokens").
+		Set("is_revoked", true).
+		Set("revoked_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Set("revoke_reason", models.RevokeReasonRotated).
+		Set("replaced_by", next.JTI).
+		Where(sq.Eq{"jti": jti}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		log.Println("Failed to revoke token: ", err)
+		return 0, err
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.DeviceName = current.DeviceName
+	next.UserAgent = current.UserAgent
+	next.Scope = current.Scope
+	next.ClientID = current.ClientID
+	if next.IPAddress == "" {
+		next.IPAddress = current.IPAddress
+	}
+
+	if err := t.insert(ctx, tx, next); err != nil {
+		return 0, err
+	}
+
+	return RotationOK, tx.Commit()
+}
+
+// RevokeFamily revokes every token of a login and returns their jtis.
+func (t *TokenImpl) RevokeFamily(ctx context.Context, familyID, reason string) ([]string, error) {
+	return t.revoke(ctx, sq.Eq{"family_id": familyID}, reason)
+}
+
+// RevokeUserFamily revokes a login of the given user and returns the jtis of
+// its tokens. No jtis are returned if the family belongs to another user.
+func (t *TokenImpl) RevokeUserFamily(ctx context.Context, userID, familyID, reason string) ([]string, error) {
+	return t.revoke(ctx, sq.Eq{"user_id": userID, "family_id": familyID}, reason)
+}
+
+// RevokeForClient revokes every token the client was issued for the user
+// and returns their jtis by family.
+func (t *TokenImpl) RevokeForClient(ctx context.Context, userID, clientID, reason string) (map[string][]string, error) {
+	return t.revokeFamilies(ctx, sq.Eq{"user_id": userID, "client_id": clientID}, reason)
+}
+
+// RevokeOtherFamilies revokes every login of the user except keepFamilyID
+// and returns the jtis of their tokens by family.
+func (t *TokenImpl) RevokeOtherFamilies(ctx context.Context, userID, keepFamilyID, reason string) (map[string][]string, error) {
+	return t.revokeFamilies(ctx, sq.And{sq.Eq{"user_id": userID}, sq.NotEq{"family_id": keepFamilyID}}, reason)
+}
+
+func (t *TokenImpl) revokeFamilies(ctx context.Context, where sq.Sqlizer, reason string) (map[string][]string, error) {
+	sqlQuery, args, err := t.sqlBuilder.Update("tokens").
+		Set("is_revoked", true).
+		Set("revoked_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Set("revoke_reason", reason).
+		Where(where).
+		Where(sq.Eq{"is_revoked": false}).
+		Suffix("RETURNING jti, family_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := t.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to revoke tokens: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := make(map[string][]string)
+	for rows.Next() {
+		var jti, familyID string
+		if err := rows.Scan(&jti, &familyID); err != nil {
+			return nil, err
+		}
+		families[familyID] = append(families[familyID], jti)
+	}
+
+	return families, rows.Err()
+}
+
+// ListSessions returns the logins of the user that still have a usable
+// refresh token, most recently used first.
+func (t *TokenImpl) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	started := t.sqlBuilder.Select("family_id", "MIN(created_at) AS created_at").
+		From("tokens").
+		Where(sq.Eq{"user_id": userID}).
+		GroupBy("family_id")
+
+	sqlQuery, args, err := t.sqlBuilder.Select(
+		"t.family_id",
+		"t.user_id",
+		"COALESCE(t.device_name, '')",
+		"COALESCE(t.user_agent, '')",
+		"COALESCE(t.ip_address, '')",
+		"f.created_at",
+		"t.created_at",
+	).From("tokens t").
+		JoinClause(started.Prefix("JOIN (").Suffix(") f ON f.family_id = t.family_id")).
+		Where(sq.Eq{"t.user_id": userID, "t.is_revoked": false}).
+		Where("t.expires_at > CURRENT_TIMESTAMP").
+		OrderBy("t.created_at DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := t.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to query sessions: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session := &models.Session{}
+		err := rows.Scan(
+			&session.SessionID,
+			&session.UserID,
+			&session.DeviceName,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+		)
+		if err != nil {
+			log.Println("Failed to scan session: ", err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeAllForUser revokes every token of the user and returns their jtis.
+func (t *TokenImpl) RevokeAllForUser(ctx context.Context, userID, reason string) ([]string, error) {
+	return t.revoke(ctx, sq.Eq{"user_id": userID}, reason)
+}
+
+func (t *TokenImpl) revoke(ctx context.Context, where sq.Eq, reason string) ([]string, error) {
+	sqlQuery, args, err := t.sqlBuilder.Update("tokens").
+		Set("is_revoked", true).
+		Set("revoked_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Set("revoke_reason", reason).
+		Where(where).
+		Where(sq.Eq{"is_revoked": false}).
+		Suffix("RETURNING jti").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	rows, err := t.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to revoke tokens: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jtis := []string{}
+	for rows.Next() {
+		var jti string
+		if err := rows.Scan(&jti); err != nil {
+			return nil, err
+		}
+		jtis = append(jtis, jti)
+	}
+
+	return jtis, rows.Err()
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (t *TokenImpl) insert(ctx context.Context, db execer, token *models.Token) error {
+	sqlQuery, args, err := t.sqlBuilder.Insert("tokens").
+		Columns("jti", "user_id", "family_id", "device_name", "user_agent", "ip_address", "scope", "client_id", "expires_at", "created_at").
+		Values(token.JTI, token.UserID, token.FamilyID, token.DeviceName, token.UserAgent, token.IPAddress, token.Scope, token.ClientID, token.ExpiresAt, token.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert token: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (t *TokenImpl) selectTokens() sq.SelectBuilder {
+	return t.sqlBuilder.Select(
+		"jti",
+		"user_id",
+		"family_id",
+		"COALESCE(device_name, '')",
+		"COALESCE(user_agent, '')",
+		"COALESCE(ip_address, '')",
+		"is_revoked",
+		"COALESCE(revoke_reason, '')",
+		"COALESCE(replaced_by::text, '')",
+		"scope",
+		"client_id",
+		"expires_at",
+		"created_at",
+	).From("tokens")
+}
+
+func scanToken(row *sql.Row) (*models.Token, error) {
+	token := &models.Token{}
+	err := row.Scan(
+		&token.JTI,
+		&token.UserID,
+		&token.FamilyID,
+		&token.DeviceName,
+		&token.UserAgent,
+		&token.IPAddress,
+		&token.IsRevoked,
+		&token.RevokeReason,
+		&token.ReplacedBy,
+		&token.Scope,
+		&token.ClientID,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
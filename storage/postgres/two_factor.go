@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type TwoFactorImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+}
+
+func NewTwoFactorSQL(db *sql.DB) *TwoFactorImpl {
+	return &TwoFactorImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+func (t *TwoFactorImpl) GetByUserID(ctx context.Context, userID string) (*models.TwoFactor, error) {
+	sqlQuery, args, err := t.sqlBuilder.Select(
+		"auth_id",
+		"user_id",
+		"secret",
+		"enabled",
+		"last_used_step",
+		"created_at",
+	).From("two_factor_auth").Where(
+		sq.Eq{"user_id": userID},
+	).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	row := t.db.QueryRowContext(ctx, sqlQuery, args...)
+	twoFactor := &models.TwoFactor{}
+	err = row.Scan(
+		&twoFactor.AuthID,
+		&twoFactor.UserID,
+		&twoFactor.Secret,
+		&twoFactor.Enabled,
+		&twoFactor.LastUsedStep,
+		&twoFactor.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		log.Println("Failed to scan two factor auth: ", err)
+		return nil, err
+	}
+
+	return twoFactor, nil
+}
+
+// SaveSecret stores a new, not yet confirmed secret for the user, replacing
+// any previous enrollment.
+func (t *TwoFactorImpl) SaveSecret(ctx context.Context, userID, secret string) error {
+	sqlQuery, args, err := t.sqlBuilder.Insert("two_factor_auth").
+		Columns("user_id", "secret", "enabled", "last_used_step").
+		Values(userID, secret, false, 0).
+		Suffix("ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = FALSE, last_used_step = 0, created_at = CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = t.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to save two factor secret: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (t *TwoFactorImpl) Enable(ctx context.Context, userID string) error {
+	sqlQuery, args, err := t.sqlBuilder.Update("two_factor_auth").
+		Set("enabled", true).
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = t.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to enable two factor auth: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// UseStep marks a TOTP time step as used. It reports false if the same or a
+// later step was already accepted, which means the code is being replayed.
+func (t *TwoFactorImpl) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	sqlQuery, args, err := t.sqlBuilder.Update("two_factor_auth").
+		Set("last_used_step", step).
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Lt{"last_used_step": step}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := t.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to update two factor step: ", err)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (t *TwoFactorImpl) Delete(ctx context.Context, userID string) error {
+	sqlQuery, args, err := t.sqlBuilder.Delete("two_factor_auth").
+		Where(sq.Eq{"user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = t.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to delete two factor auth: ", err)
+		return err
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"auth_service/models"
+	"auth_service/pkg/hasher"
 	"auth_service/storage/cache"
 	"context"
 	"database/sql"
@@ -9,26 +10,27 @@ import (
 	"log"
 
 	sq "github.com/Masterminds/squirrel"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserManagementImpl struct {
 	db         *sql.DB
 	sqlBuilder sq.StatementBuilderType
 	cache      *cache.AuthCache
+	hasher     *hasher.Hasher
 }
 
-func NewUserManagementSQL(db *sql.DB, cache *cache.AuthCache) *UserManagementImpl {
+func NewUserManagementSQL(db *sql.DB, cache *cache.AuthCache, hasher *hasher.Hasher) *UserManagementImpl {
 	return &UserManagementImpl{
 		db:         db,
 		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
 		cache:      cache,
+		hasher:     hasher,
 	}
 }
 
 func (a *UserManagementImpl) CreateUser(ctx context.Context, req *models.User) (*models.User, error) {
 	// Hash password and insert new user into the database
-	hashedPassword, err := HashPassword(req.HashedPassword)
+	hashedPassword, err := a.hasher.Hash(req.HashedPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +63,11 @@ func (a *UserManagementImpl) CreateUser(ctx context.Context, req *models.User) (
 }
 
 func (a *UserManagementImpl) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	// Users who signed up with a phone number have no email.
+	if email == "" {
+		return nil, sql.ErrNoRows
+	}
+
 	// Check cache by email first
 	cachedUser, err := a.cache.GetUserByEmail(ctx, email)
 	if err != nil {
@@ -73,35 +80,15 @@ func (a *UserManagementImpl) GetByEmail(ctx context.Context, email string) (*mod
 	}
 
 	// Check database
-	sqlQuery, args, err := a.sqlBuilder.Select(
-		"user_id",
-		"email",
-		"hashed_password",
-		"name",
-		"created_at",
-		"updated_at",
-	).From("users").Where(
+	sqlQuery, args, err := a.selectUsers().Where(
 		sq.Eq{"email": email},
 	).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build SQL query: %v", err)
 	}
 
-	row := a.db.QueryRowContext(ctx, sqlQuery, args...)
-	user := &models.User{}
-	err = row.Scan(
-		&user.UserId,
-		&user.Email,
-		&user.HashedPassword,
-		&user.Name,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(a.db.QueryRowContext(ctx, sqlQuery, args...))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, sql.ErrNoRows
-		}
-		log.Println("Failed to scan user: ", err)
 		return nil, err
 	}
 
@@ -125,20 +112,24 @@ func (a *UserManagementImpl) VerifiyUser(ctx context.Context, email string) erro
 	sqlQuery, args, err := a.sqlBuilder.Update("users").
 		Set("is_verified", true).
 		Where(sq.Eq{"email": email}).
+		Suffix("RETURNING user_id").
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build SQL query: %v", err)
 	}
 
-	_, err = a.db.ExecContext(ctx, sqlQuery, args...)
-	if err != nil {
+	var userID string
+	err = a.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
 		log.Println("Failed to update user: ", err)
 		return err
 	}
 
-	return nil
+	return a.invalidateCache(ctx, &models.User{UserId: userID, Email: email})
 }
 
+// UpdateUser updates the profile fields of a user. The password is left
+// untouched, use UpdatePassword to change it.
 func (a *UserManagementImpl) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	// Update database
 	eq := sq.Eq{}
@@ -149,11 +140,10 @@ func (a *UserManagementImpl) UpdateUser(ctx context.Context, user *models.User)
 	}
 
 	sqlQuery, args, err := a.sqlBuilder.Update("users").
-		Set("email", user.Email).
-		Set("hashed_password", user.HashedPassword).
+		Set("email", sq.Expr("NULLIF(?, '')", user.Email)).
 		Set("name", user.Name).
 		Set("is_verified", user.IsVerified).
-		Set("updated_at", user.UpdatedAt).
+		Set("updated_at", sq.Expr("CURRENT_TIMESTAMP")).
 		Where(eq).
 		ToSql()
 	if err != nil {
@@ -166,20 +156,58 @@ func (a *UserManagementImpl) UpdateUser(ctx context.Context, user *models.User)
 		return nil, err
 	}
 
-	// Update cache by both ID and email
-	err = a.cache.CreateOrUpdateUserByID(ctx, user)
-	if err != nil {
-		log.Println("Redis Error: ", err)
+	// The caller's copy may carry a stale hashed_password, so drop the cached
+	// entries and let the next read load the stored row.
+	if err := a.invalidateCache(ctx, user); err != nil {
 		return nil, err
 	}
 
-	err = a.cache.CreateOrUpdateUserByEmail(ctx, user)
+	return user, nil
+}
+
+// UpdatePassword stores a new password hash for the user.
+func (a *UserManagementImpl) UpdatePassword(ctx context.Context, userId, hashedPassword string) error {
+	user, err := a.GetByID(ctx, userId)
 	if err != nil {
-		log.Println("Redis Error: ", err)
-		return nil, err
+		return err
 	}
 
-	return user, nil
+	sqlQuery, args, err := a.sqlBuilder.Update("users").
+		Set("hashed_password", hashedPassword).
+		Set("updated_at", sq.Expr("CURRENT_TIMESTAMP")).
+		Where(sq.Eq{"user_id": userId}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = a.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to update password: ", err)
+		return err
+	}
+
+	return a.invalidateCache(ctx, user)
+}
+
+func (a *UserManagementImpl) invalidateCache(ctx context.Context, user *models.User) error {
+	if user.UserId != "" {
+		err := a.cache.DeleteUserByID(ctx, user.UserId)
+		if err != nil {
+			log.Println("Redis Error: ", err)
+			return err
+		}
+	}
+
+	if user.Email != "" {
+		err := a.cache.DeleteUserByEmail(ctx, user.Email)
+		if err != nil {
+			log.Println("Redis Error: ", err)
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (a *UserManagementImpl) DeleteUser(ctx context.Context, userId string) error {
@@ -222,7 +250,7 @@ func (a *UserManagementImpl) DeleteUser(ctx context.Context, userId string) erro
 func (a *UserManagementImpl) InsertUser(ctx context.Context, email, hashedPassword, name string, isVerified bool) error {
 	sqlQuery, args, err := a.sqlBuilder.Insert("users").
 		Columns("email", "hashed_password", "name", "created_at", "is_verified").
-		Values(email, hashedPassword, name, "NOW()", isVerified).
+		Values(sq.Expr("NULLIF(?, '')", email), hashedPassword, name, "NOW()", isVerified).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build SQL query: %v", err)
@@ -250,37 +278,15 @@ func (a *UserManagementImpl) GetByID(ctx context.Context, userId string) (*model
 	}
 
 	// Check database
-	sqlQuery, args, err := a.sqlBuilder.Select(
-		"user_id",
-		"email",
-		"hashed_password",
-		"name",
-		"created_at",
-		"updated_at",
-		"is_verified",
-	).From("users").Where(
+	sqlQuery, args, err := a.selectUsers().Where(
 		sq.Eq{"user_id": userId},
 	).ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build SQL query: %v", err)
 	}
 
-	row := a.db.QueryRowContext(ctx, sqlQuery, args...)
-	user := &models.User{}
-	err = row.Scan(
-		&user.UserId,
-		&user.Email,
-		&user.HashedPassword,
-		&user.Name,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.IsVerified,
-	)
+	user, err := scanUser(a.db.QueryRowContext(ctx, sqlQuery, args...))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, sql.ErrNoRows
-		}
-		log.Println("Failed to scan user: ", err)
 		return nil, err
 	}
 
@@ -300,23 +306,129 @@ func (a *UserManagementImpl) GetByID(ctx context.Context, userId string) (*model
 	return user, nil
 }
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (a *UserManagementImpl) GetTokenGeneration(ctx context.Context, userId string) (int64, error) {
+	sqlQuery, args, err := a.sqlBuilder.Select("token_generation").
+		From("users").
+		Where(sq.Eq{"user_id": userId}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var generation int64
+	err = a.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&generation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, sql.ErrNoRows
+		}
+		log.Println("Failed to get token generation: ", err)
+		return 0, err
+	}
+
+	return generation, nil
+}
+
+// IncrementTokenGeneration bumps the token generation of the user, which
+// invalidates every token issued so far, and returns the new generation.
+func (a *UserManagementImpl) IncrementTokenGeneration(ctx context.Context, userId string) (int64, error) {
+	sqlQuery, args, err := a.sqlBuilder.Update("users").
+		Set("token_generation", sq.Expr("token_generation + 1")).
+		Where(sq.Eq{"user_id": userId}).
+		Suffix("RETURNING token_generation").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	var generation int64
+	err = a.db.QueryRowContext(ctx, sqlQuery, args...).Scan(&generation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, sql.ErrNoRows
+		}
+		log.Println("Failed to increment token generation: ", err)
+		return 0, err
+	}
+
+	return generation, nil
+}
+
+// GetByPhone returns the user who signs in with the phone number. Users are
+// looked up by phone only at login, so they aren't cached by it.
+func (a *UserManagementImpl) GetByPhone(ctx context.Context, phoneNumber string) (*models.User, error) {
+	sqlQuery, args, err := a.selectUsers().Where(
+		sq.Eq{"phone_number": phoneNumber},
+	).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	return scanUser(a.db.QueryRowContext(ctx, sqlQuery, args...))
+}
+
+// CreatePhoneUser creates a verified user without email and password for a
+// phone number that passed an SMS check. If the number was taken meanwhile,
+// the existing user is returned with created set to false.
+func (a *UserManagementImpl) CreatePhoneUser(ctx context.Context, phoneNumber string) (user *models.User, created bool, err error) {
+	sqlQuery, args, err := a.sqlBuilder.Insert("users").
+		Columns("phone_number", "hashed_password", "name", "is_verified").
+		Values(phoneNumber, "", "user", true).
+		Suffix("ON CONFLICT (phone_number) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	res, err := a.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert user: ", err)
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err = a.GetByPhone(ctx, phoneNumber)
 	if err != nil {
-		log.Println("Error hashing password:", err)
-		return "", err
+		return nil, false, err
 	}
-	return string(hashedPassword), nil
+
+	return user, n > 0, nil
 }
 
-func ComparePassword(hashedPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+func (a *UserManagementImpl) selectUsers() sq.SelectBuilder {
+	return a.sqlBuilder.Select(
+		"user_id",
+		"COALESCE(email, '')",
+		"COALESCE(phone_number, '')",
+		"hashed_password",
+		"name",
+		"created_at",
+		"updated_at",
+		"is_verified",
+	).From("users")
+}
+
+func scanUser(row *sql.Row) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.UserId,
+		&user.Email,
+		&user.PhoneNumber,
+		&user.HashedPassword,
+		&user.Name,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsVerified,
+	)
 	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return false
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
 		}
-		log.Println("Error comparing passwords:", err)
-		return false
+		log.Println("Failed to scan user: ", err)
+		return nil, err
 	}
-	return true
+
+	return user, nil
 }
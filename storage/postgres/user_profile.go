@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type UserProfileImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+	cache      *cache.ProfileCache
+}
+
+func NewUserProfileSQL(db *sql.DB, cache *cache.ProfileCache) *UserProfileImpl {
+	return &UserProfileImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+		cache:      cache,
+	}
+}
+
+// GetByUserID returns the profile of a user, or sql.ErrNoRows if the user
+// never saved one.
+func (p *UserProfileImpl) GetByUserID(ctx context.Context, userID string) (*models.UserProfile, error) {
+	cachedProfile, err := p.cache.GetProfile(ctx, userID)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return nil, err
+	}
+
+	if cachedProfile != nil {
+		return cachedProfile, nil
+	}
+
+	sqlQuery, args, err := p.sqlBuilder.Select(
+		"user_id",
+		"first_name",
+		"last_name",
+		"phone_number",
+		"profile_picture",
+		"updated_at",
+	).From("user_profiles").Where(
+		sq.Eq{"user_id": userID},
+	).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	profile := &models.UserProfile{}
+	err = p.db.QueryRowContext(ctx, sqlQuery, args...).Scan(
+		&profile.UserID,
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.PhoneNumber,
+		&profile.ProfilePicture,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		log.Println("Failed to scan user profile: ", err)
+		return nil, err
+	}
+
+	err = p.cache.SetProfile(ctx, profile)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// Upsert creates the profile or replaces all of its fields.
+func (p *UserProfileImpl) Upsert(ctx context.Context, profile *models.UserProfile) error {
+	sqlQuery, args, err := p.sqlBuilder.Insert("user_profiles").
+		Columns("user_id", "first_name", "last_name", "phone_number", "profile_picture").
+		Values(profile.UserID, profile.FirstName, profile.LastName, profile.PhoneNumber, profile.ProfilePicture).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			first_name = EXCLUDED.first_name,
+			last_name = EXCLUDED.last_name,
+			phone_number = EXCLUDED.phone_number,
+			profile_picture = EXCLUDED.profile_picture,
+			updated_at = CURRENT_TIMESTAMP`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to upsert user profile: ", err)
+		return err
+	}
+
+	// Let the next read load the stored row, with its updated_at.
+	err = p.cache.DeleteProfile(ctx, profile.UserID)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return err
+	}
+
+	return nil
+}
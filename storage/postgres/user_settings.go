@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"auth_service/models"
+	"auth_service/storage/cache"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type UserSettingsImpl struct {
+	db         *sql.DB
+	sqlBuilder sq.StatementBuilderType
+	cache      *cache.SettingsCache
+}
+
+func NewUserSettingsSQL(db *sql.DB, cache *cache.SettingsCache) *UserSettingsImpl {
+	return &UserSettingsImpl{
+		db:         db,
+		sqlBuilder: sq.StatementBuilderType{}.PlaceholderFormat(sq.Dollar),
+		cache:      cache,
+	}
+}
+
+// Create stores the first settings of a user. Existing settings are kept.
+func (s *UserSettingsImpl) Create(ctx context.Context, settings *models.UserSettings) error {
+	sqlQuery, args, err := s.sqlBuilder.Insert("user_settings").
+		Columns("user_id", "language", "time_zone", "notification_preferences").
+		Values(settings.UserID, settings.Language, settings.TimeZone, settings.NotificationPreferences).
+		Suffix("ON CONFLICT (user_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to insert user settings: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetByUserID returns the settings of a user, or sql.ErrNoRows if there are
+// none.
+func (s *UserSettingsImpl) GetByUserID(ctx context.Context, userID string) (*models.UserSettings, error) {
+	cachedSettings, err := s.cache.GetSettings(ctx, userID)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return nil, err
+	}
+
+	if cachedSettings != nil {
+		return cachedSettings, nil
+	}
+
+	sqlQuery, args, err := s.sqlBuilder.Select(
+		"user_id",
+		"language",
+		"time_zone",
+		"notification_preferences",
+		"updated_at",
+	).From("user_settings").Where(
+		sq.Eq{"user_id": userID},
+	).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	settings := &models.UserSettings{}
+	err = s.db.QueryRowContext(ctx, sqlQuery, args...).Scan(
+		&settings.UserID,
+		&settings.Language,
+		&settings.TimeZone,
+		&settings.NotificationPreferences,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+		log.Println("Failed to scan user settings: ", err)
+		return nil, err
+	}
+
+	err = s.cache.SetSettings(ctx, settings)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// Upsert creates the settings or replaces all of them.
+func (s *UserSettingsImpl) Upsert(ctx context.Context, settings *models.UserSettings) error {
+	sqlQuery, args, err := s.sqlBuilder.Insert("user_settings").
+		Columns("user_id", "language", "time_zone", "notification_preferences").
+		Values(settings.UserID, settings.Language, settings.TimeZone, settings.NotificationPreferences).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			language = EXCLUDED.language,
+			time_zone = EXCLUDED.time_zone,
+			notification_preferences = EXCLUDED.notification_preferences,
+			updated_at = CURRENT_TIMESTAMP`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		log.Println("Failed to upsert user settings: ", err)
+		return err
+	}
+
+	err = s.cache.DeleteSettings(ctx, settings.UserID)
+	if err != nil {
+		log.Println("Redis Error: ", err)
+		return err
+	}
+
+	return nil
+}